@@ -0,0 +1,395 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/jbuet/kubectl-debug/debug"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"sigs.k8s.io/yaml"
+)
+
+// configEnvPrefix prefixes the environment variables that set defaults,
+// KUBECTL_DEBUG_MEMORY_LIMIT sets --memory-limit
+const configEnvPrefix = "KUBECTL_DEBUG_"
+
+// configKeys are the flags whose defaults the config file and the
+// environment can set
+var configKeys = []string{
+	"image",
+	"toolkit",
+	"profile",
+	"profiles-configmap",
+	"ttl",
+	"timeout",
+	"cpu-request",
+	"cpu-limit",
+	"memory-request",
+	"memory-limit",
+	"ephemeral-storage-request",
+	"ephemeral-storage-limit",
+	"qos",
+	"pick",
+	"concurrency",
+	"all-output",
+}
+
+// configScope holds defaults and the per-namespace defaults that override them
+type configScope struct {
+	Defaults   map[string]string            `json:"defaults,omitempty"`
+	Namespaces map[string]map[string]string `json:"namespaces,omitempty"`
+}
+
+// Config is the kubectl-debug config file. Settings are applied from the
+// least to the most specific: global defaults, global namespace defaults,
+// context defaults and context namespace defaults.
+type Config struct {
+	configScope `json:",inline"`
+	Contexts    map[string]configScope `json:"contexts,omitempty"`
+	// Toolkits extends the toolkit catalog
+	Toolkits map[string]debug.Toolkit `json:"toolkits,omitempty"`
+}
+
+// configSetting is a default and where it comes from, for error messages
+type configSetting struct {
+	value  string
+	source string
+}
+
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Manage the kubectl-debug defaults",
+	Long: `config manages the defaults of kubectl-debug flags, stored in
+~/.config/kubectl-debug/config.yaml (or $KUBECTL_DEBUG_CONFIG).
+
+Defaults apply globally, or to a kube-context with --context and to a
+namespace with --namespace. KUBECTL_DEBUG_<FLAG> environment variables such
+as KUBECTL_DEBUG_IMAGE override the file, and flags override both.
+
+Keys: ` + strings.Join(configKeys, ", ") + `
+
+Toolkits are added to the catalog under toolkits in the file.`,
+	// The config file is managed without a cluster
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		return nil
+	},
+}
+
+var configViewCmd = &cobra.Command{
+	Use:   "view",
+	Short: "Print the config file",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		config, err := loadConfig(configFile())
+		if err != nil {
+			return err
+		}
+		data, err := yaml.Marshal(config)
+		if err != nil {
+			return fmt.Errorf("error marshaling YAML: %v", err)
+		}
+		fmt.Print(string(data))
+		return nil
+	},
+}
+
+var configSetCmd = &cobra.Command{
+	Use:   "set KEY VALUE",
+	Short: "Set a default, for a context and namespace with --context and --namespace",
+	Args:  cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return setConfig(args[0], args[1])
+	},
+}
+
+var configUnsetCmd = &cobra.Command{
+	Use:   "unset KEY",
+	Short: "Remove a default, for a context and namespace with --context and --namespace",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return unsetConfig(args[0])
+	},
+}
+
+func init() {
+	configCmd.AddCommand(configViewCmd, configSetCmd, configUnsetCmd)
+	rootCmd.AddCommand(configCmd)
+}
+
+// configFile returns the path of the config file
+func configFile() string {
+	if path := os.Getenv(configEnvPrefix + "CONFIG"); path != "" {
+		return path
+	}
+	dir := debug.ConfigDir()
+	if dir == "" {
+		return ""
+	}
+	return filepath.Join(dir, "config.yaml")
+}
+
+// loadConfig reads the config file, a missing file is an empty config
+func loadConfig(path string) (*Config, error) {
+	config := &Config{}
+	if path == "" {
+		return config, nil
+	}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return config, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading config file: %v", err)
+	}
+	if err := yaml.UnmarshalStrict(data, config); err != nil {
+		return nil, fmt.Errorf("error parsing config file %s: %v", path, err)
+	}
+	return config, nil
+}
+
+func saveConfig(path string, config *Config) error {
+	if path == "" {
+		return fmt.Errorf("cannot locate the config file, set %sCONFIG", configEnvPrefix)
+	}
+	data, err := yaml.Marshal(config)
+	if err != nil {
+		return fmt.Errorf("error marshaling YAML: %v", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("error creating config directory: %v", err)
+	}
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		return fmt.Errorf("error writing config file: %v", err)
+	}
+	return nil
+}
+
+// settings returns the defaults of the config for a context and namespace
+func (c *Config) settings(kubeContext, namespace string) map[string]configSetting {
+	settings := map[string]configSetting{}
+	add := func(values map[string]string, source string) {
+		for key, value := range values {
+			settings[key] = configSetting{value: value, source: source}
+		}
+	}
+
+	add(c.Defaults, "config file")
+	add(c.Namespaces[namespace], fmt.Sprintf("config file, namespace %s", namespace))
+	if scope, ok := c.Contexts[kubeContext]; ok && kubeContext != "" {
+		add(scope.Defaults, fmt.Sprintf("config file, context %s", kubeContext))
+		add(scope.Namespaces[namespace], fmt.Sprintf("config file, context %s namespace %s", kubeContext, namespace))
+	}
+	return settings
+}
+
+// scope returns the settings --context and --namespace select, creating
+// them when create is set
+func (c *Config) scope(kubeContext, namespace string, create bool) map[string]string {
+	scope := &c.configScope
+	if kubeContext != "" {
+		s, ok := c.Contexts[kubeContext]
+		if !ok && !create {
+			return nil
+		}
+		if c.Contexts == nil {
+			c.Contexts = map[string]configScope{}
+		}
+		defer func() { c.Contexts[kubeContext] = s }()
+		scope = &s
+	}
+
+	if namespace == "" {
+		if scope.Defaults == nil && create {
+			scope.Defaults = map[string]string{}
+		}
+		return scope.Defaults
+	}
+	if scope.Namespaces[namespace] == nil && create {
+		if scope.Namespaces == nil {
+			scope.Namespaces = map[string]map[string]string{}
+		}
+		scope.Namespaces[namespace] = map[string]string{}
+	}
+	return scope.Namespaces[namespace]
+}
+
+// prune drops the scopes left empty by unset
+func (c *Config) prune() {
+	pruneScope := func(scope *configScope) {
+		for namespace, values := range scope.Namespaces {
+			if len(values) == 0 {
+				delete(scope.Namespaces, namespace)
+			}
+		}
+		if len(scope.Namespaces) == 0 {
+			scope.Namespaces = nil
+		}
+		if len(scope.Defaults) == 0 {
+			scope.Defaults = nil
+		}
+	}
+
+	pruneScope(&c.configScope)
+	for name, scope := range c.Contexts {
+		pruneScope(&scope)
+		if scope.Defaults == nil && scope.Namespaces == nil {
+			delete(c.Contexts, name)
+			continue
+		}
+		c.Contexts[name] = scope
+	}
+	if len(c.Contexts) == 0 {
+		c.Contexts = nil
+	}
+}
+
+func isConfigKey(key string) bool {
+	for _, k := range configKeys {
+		if k == key {
+			return true
+		}
+	}
+	return false
+}
+
+// envSettings returns the defaults set by KUBECTL_DEBUG_* variables
+func envSettings() map[string]configSetting {
+	settings := map[string]configSetting{}
+	for _, key := range configKeys {
+		name := configEnvPrefix + strings.ToUpper(strings.ReplaceAll(key, "-", "_"))
+		if value, ok := os.LookupEnv(name); ok {
+			settings[key] = configSetting{value: value, source: name}
+		}
+	}
+	return settings
+}
+
+// applyConfig sets the flags not given on the command line from the
+// environment and the config file, for the context and namespace in use
+func applyConfig(flags *pflag.FlagSet) error {
+	config, err := loadConfig(configFile())
+	if err != nil {
+		return err
+	}
+	kubeContext, err := cli.ContextName()
+	if err != nil {
+		return err
+	}
+
+	for name, tk := range config.Toolkits {
+		if cli.Toolkits == nil {
+			cli.Toolkits = map[string]debug.Toolkit{}
+		}
+		tk.Source = "config file"
+		cli.Toolkits[name] = tk
+	}
+
+	settings := config.settings(kubeContext, cli.Namespace)
+	for key, setting := range envSettings() {
+		settings[key] = setting
+	}
+
+	keys := make([]string, 0, len(settings))
+	for key := range settings {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		setting := settings[key]
+		if !isConfigKey(key) {
+			return fmt.Errorf("unknown key %q in %s: must be one of: %s", key, setting.source, strings.Join(configKeys, ", "))
+		}
+		flag := flags.Lookup(key)
+		if flag == nil || flag.Changed {
+			continue
+		}
+		if err := flag.Value.Set(setting.value); err != nil {
+			return fmt.Errorf("invalid %s %q in %s: %v", key, setting.value, setting.source, err)
+		}
+	}
+	return nil
+}
+
+// validateConfigValue checks a value like the flag it sets would
+func validateConfigValue(key, value string) error {
+	if !isConfigKey(key) {
+		return fmt.Errorf("unknown key %q: must be one of: %s", key, strings.Join(configKeys, ", "))
+	}
+	flag := rootCmd.PersistentFlags().Lookup(key)
+	previous := flag.Value.String()
+	defer flag.Value.Set(previous)
+	if err := flag.Value.Set(value); err != nil {
+		return fmt.Errorf("invalid %s %q: %v", key, value, err)
+	}
+	return nil
+}
+
+// describeScope names the scope --context and --namespace select
+func describeScope() string {
+	switch {
+	case cli.KubeContext != "" && cli.Namespace != "":
+		return fmt.Sprintf("context %s namespace %s", cli.KubeContext, cli.Namespace)
+	case cli.KubeContext != "":
+		return fmt.Sprintf("context %s", cli.KubeContext)
+	case cli.Namespace != "":
+		return fmt.Sprintf("namespace %s", cli.Namespace)
+	}
+	return "all contexts"
+}
+
+func setConfig(key, value string) error {
+	if err := validateConfigValue(key, value); err != nil {
+		return err
+	}
+	path := configFile()
+	config, err := loadConfig(path)
+	if err != nil {
+		return err
+	}
+	config.scope(cli.KubeContext, cli.Namespace, true)[key] = value
+	if err := saveConfig(path, config); err != nil {
+		return err
+	}
+	fmt.Printf("Set %s to %q for %s\n", key, value, describeScope())
+	return nil
+}
+
+func unsetConfig(key string) error {
+	if !isConfigKey(key) {
+		return fmt.Errorf("unknown key %q: must be one of: %s", key, strings.Join(configKeys, ", "))
+	}
+	path := configFile()
+	config, err := loadConfig(path)
+	if err != nil {
+		return err
+	}
+	values := config.scope(cli.KubeContext, cli.Namespace, false)
+	if _, ok := values[key]; !ok {
+		fmt.Printf("%s is not set for %s\n", key, describeScope())
+		return nil
+	}
+	delete(values, key)
+	config.prune()
+	if err := saveConfig(path, config); err != nil {
+		return err
+	}
+	fmt.Printf("Unset %s for %s\n", key, describeScope())
+	return nil
+}
+
+// Export functions for testing
+func ApplyConfig() error {
+	return applyConfig(rootCmd.PersistentFlags())
+}
+
+func SetConfig(key, value string) error {
+	return setConfig(key, value)
+}
+
+func UnsetConfig(key string) error {
+	return unsetConfig(key)
+}
@@ -0,0 +1,92 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/jbuet/kubectl-debug/debug"
+	"github.com/spf13/cobra"
+	"sigs.k8s.io/yaml"
+)
+
+// DoctorCheck is the result of one environment or cluster check
+type DoctorCheck = debug.DoctorCheck
+
+var doctorCmd = &cobra.Command{
+	Use:   "doctor",
+	Short: "Check the local environment and what the cluster allows for debugging",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		switch outputFormat {
+		case "table", "json", "yaml":
+		default:
+			return fmt.Errorf("invalid output format %q: must be one of: table, json, yaml", outputFormat)
+		}
+
+		if err := validateToolkit(cmd.Flags()); err != nil {
+			return err
+		}
+		if err := cli.LoadProfiles(cmd.Context()); err != nil {
+			return err
+		}
+
+		checks := cli.Doctor(cmd.Context())
+		if err := printDoctorChecks(checks); err != nil {
+			return err
+		}
+
+		failed := 0
+		for _, c := range checks {
+			if c.Status == debug.StatusFail {
+				failed++
+			}
+		}
+		if failed > 0 {
+			return fmt.Errorf("%d check(s) failed", failed)
+		}
+		return nil
+	},
+}
+
+func init() {
+	doctorCmd.Flags().StringVarP(&outputFormat, "output", "o", "table", "output format (table, json, yaml)")
+	rootCmd.AddCommand(doctorCmd)
+}
+
+func printDoctorChecks(checks []DoctorCheck) error {
+	switch outputFormat {
+	case "json":
+		data, err := json.MarshalIndent(checks, "", "  ")
+		if err != nil {
+			return fmt.Errorf("error marshaling JSON: %v", err)
+		}
+		fmt.Println(string(data))
+		return nil
+	case "yaml":
+		data, err := yaml.Marshal(checks)
+		if err != nil {
+			return fmt.Errorf("error marshaling YAML: %v", err)
+		}
+		fmt.Print(string(data))
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(w, "CHECK\tSTATUS\tMESSAGE")
+	for _, c := range checks {
+		fmt.Fprintf(w, "%s\t%s\t%s\n", c.Name, strings.ToUpper(c.Status), c.Message)
+	}
+	return w.Flush()
+}
+
+// Export functions for testing
+func RunDoctor() []DoctorCheck {
+	return cli.Doctor(context.Background())
+}
+
+func NormalizeImage(ref string) string {
+	return debug.NormalizeImage(ref)
+}
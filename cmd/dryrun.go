@@ -0,0 +1,56 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/jbuet/kubectl-debug/debug"
+	"sigs.k8s.io/yaml"
+)
+
+var (
+	dryRun       string
+	dryRunFormat string
+)
+
+func validateDryRun() error {
+	switch dryRun {
+	case "none", "client":
+	default:
+		return fmt.Errorf("invalid dry-run value %q: must be one of: none, client", dryRun)
+	}
+
+	switch dryRunFormat {
+	case "yaml", "json":
+	default:
+		return fmt.Errorf("invalid output format %q: must be one of: yaml, json", dryRunFormat)
+	}
+	return nil
+}
+
+func printDryRun(result *debug.DryRunResult) error {
+	if dryRunFormat == "json" {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		encoder.SetEscapeHTML(false)
+		if err := encoder.Encode(result); err != nil {
+			return fmt.Errorf("error marshaling dry-run output: %v", err)
+		}
+		return nil
+	}
+
+	data, err := yaml.Marshal(result)
+	if err != nil {
+		return fmt.Errorf("error marshaling dry-run output: %v", err)
+	}
+	fmt.Print(string(data))
+	return nil
+}
+
+// Export functions for testing
+func SetDryRun(value, format string) {
+	dryRun = value
+	dryRunFormat = format
+	cli.DryRun = value == "client"
+}
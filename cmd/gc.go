@@ -0,0 +1,110 @@
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/jbuet/kubectl-debug/debug"
+	"github.com/spf13/cobra"
+	"k8s.io/apimachinery/pkg/util/duration"
+)
+
+var (
+	gcOlderThan time.Duration
+	gcTarget    string
+	gcCreator   string
+	gcExpired   bool
+	gcDryRun    bool
+)
+
+var gcCmd = &cobra.Command{
+	Use:   "gc",
+	Short: "Delete stale debug pods",
+	Long: `gc deletes debug pods and pod copies created by kubectl-debug.
+Pods can be filtered by age, target and creator; --expired selects pods whose
+TTL has passed or that already finished. Ephemeral containers are never
+deleted since that would require deleting the pod they debug.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runGC(cmd.Context())
+	},
+}
+
+func init() {
+	gcCmd.Flags().BoolVarP(&allNamespaces, "all-namespaces", "A", false, "collect debug pods across all namespaces")
+	gcCmd.Flags().DurationVar(&gcOlderThan, "older-than", 0, "only delete debug pods older than this duration (e.g. 2h)")
+	gcCmd.Flags().StringVar(&gcTarget, "target", "", "only delete debug pods for this target")
+	gcCmd.Flags().StringVar(&gcCreator, "creator", "", "only delete debug pods created by this user")
+	gcCmd.Flags().BoolVar(&gcExpired, "expired", false, "only delete debug pods whose TTL expired or that already finished")
+	gcCmd.Flags().BoolVar(&gcDryRun, "dry-run", false, "only print the debug pods that would be deleted")
+	rootCmd.AddCommand(gcCmd)
+}
+
+func askForGC(count int) bool {
+	fmt.Printf("Delete %d debug pod(s)? (y/N): ", count)
+	reader := bufio.NewReader(os.Stdin)
+	response, err := reader.ReadString('\n')
+	if err != nil {
+		return false
+	}
+	response = strings.ToLower(strings.TrimSpace(response))
+	return response == "y" || response == "yes"
+}
+
+func runGC(ctx context.Context) error {
+	candidates, err := cli.GCCandidates(ctx, debug.GCFilter{
+		AllNamespaces: allNamespaces,
+		OlderThan:     gcOlderThan,
+		Target:        gcTarget,
+		Creator:       gcCreator,
+		Expired:       gcExpired,
+	})
+	if err != nil {
+		return err
+	}
+	if len(candidates) == 0 {
+		fmt.Println("No debug pods to delete")
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(w, "NAMESPACE\tPOD\tTYPE\tTARGET\tCREATOR\tAGE\tPHASE")
+	for _, s := range candidates {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			s.Namespace, s.Pod, s.Type, orNone(s.Target), orNone(s.Creator), duration.HumanDuration(time.Since(s.Created)), s.Phase)
+	}
+	w.Flush()
+
+	if gcDryRun {
+		fmt.Printf("%d debug pod(s) would be deleted (dry run)\n", len(candidates))
+		return nil
+	}
+	if !cli.Force && !askForGC(len(candidates)) {
+		return nil
+	}
+	return cli.DeletePods(ctx, candidates)
+}
+
+// Export functions for testing
+func SetTTL(d time.Duration) {
+	cli.TTL = d
+}
+
+func SetGCFilters(olderThan time.Duration, target, creator string, expired bool) {
+	gcOlderThan = olderThan
+	gcTarget = target
+	gcCreator = creator
+	gcExpired = expired
+}
+
+func SetGCDryRun(value bool) {
+	gcDryRun = value
+}
+
+func RunGC() error {
+	return runGC(context.Background())
+}
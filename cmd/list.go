@@ -0,0 +1,109 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/jbuet/kubectl-debug/debug"
+	"github.com/spf13/cobra"
+	"k8s.io/apimachinery/pkg/util/duration"
+	"sigs.k8s.io/yaml"
+)
+
+var (
+	allNamespaces bool
+	outputFormat  string
+)
+
+// DebugSession describes a debug pod or ephemeral debugger container
+type DebugSession = debug.DebugSession
+
+var listCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List active debug pods and ephemeral debug containers",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		switch outputFormat {
+		case "table", "json", "yaml":
+		default:
+			return fmt.Errorf("invalid output format %q: must be one of: table, json, yaml", outputFormat)
+		}
+
+		sessions, err := cli.ListSessions(cmd.Context(), allNamespaces)
+		if err != nil {
+			return err
+		}
+		return printDebugSessions(sessions)
+	},
+}
+
+func init() {
+	listCmd.Flags().BoolVarP(&allNamespaces, "all-namespaces", "A", false, "list debug sessions across all namespaces")
+	listCmd.Flags().StringVarP(&outputFormat, "output", "o", "table", "output format (table, json, yaml)")
+	rootCmd.AddCommand(listCmd)
+}
+
+func printDebugSessions(sessions []DebugSession) error {
+	switch outputFormat {
+	case "json":
+		data, err := json.MarshalIndent(sessions, "", "  ")
+		if err != nil {
+			return fmt.Errorf("error marshaling JSON: %v", err)
+		}
+		fmt.Println(string(data))
+		return nil
+	case "yaml":
+		data, err := yaml.Marshal(sessions)
+		if err != nil {
+			return fmt.Errorf("error marshaling YAML: %v", err)
+		}
+		fmt.Print(string(data))
+		return nil
+	}
+
+	if len(sessions) == 0 {
+		if allNamespaces {
+			fmt.Println("No debug sessions found")
+		} else {
+			fmt.Printf("No debug sessions found in namespace %s\n", cli.Namespace)
+		}
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	if allNamespaces {
+		fmt.Fprint(w, "NAMESPACE\t")
+	}
+	fmt.Fprintln(w, "POD\tCONTAINER\tTYPE\tTARGET\tPROFILE\tIMAGE\tCREATOR\tAGE\tNODE\tPHASE")
+	for _, s := range sessions {
+		if allNamespaces {
+			fmt.Fprintf(w, "%s\t", s.Namespace)
+		}
+		age := "<unknown>"
+		if !s.Created.IsZero() {
+			age = duration.HumanDuration(time.Since(s.Created))
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			s.Pod, s.Container, s.Type, orNone(s.Target), orNone(s.Profile), s.Image, orNone(s.Creator), age, orNone(s.Node), s.Phase)
+	}
+	return w.Flush()
+}
+
+func orNone(value string) string {
+	if value == "" {
+		return "<none>"
+	}
+	return value
+}
+
+// Export functions for testing
+func SetAllNamespaces(value bool) {
+	allNamespaces = value
+}
+
+func ListDebugSessions() ([]DebugSession, error) {
+	return cli.ListSessions(context.Background(), allNamespaces)
+}
@@ -0,0 +1,102 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/jbuet/kubectl-debug/debug"
+	"github.com/spf13/cobra"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/yaml"
+)
+
+type profileList struct {
+	Profiles []debug.SecurityProfile `json:"profiles"`
+}
+
+var profilesCmd = &cobra.Command{
+	Use:   "profiles",
+	Short: "List the available security profiles",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		switch outputFormat {
+		case "table", "json", "yaml":
+		default:
+			return fmt.Errorf("invalid output format %q: must be one of: table, json, yaml", outputFormat)
+		}
+
+		if err := cli.LoadProfiles(cmd.Context()); err != nil {
+			return err
+		}
+		return printProfiles()
+	},
+}
+
+func init() {
+	profilesCmd.Flags().StringVarP(&outputFormat, "output", "o", "table", "output format (table, json, yaml)")
+	rootCmd.AddCommand(profilesCmd)
+}
+
+func printProfiles() error {
+	profiles := cli.Profiles()
+
+	switch outputFormat {
+	case "json":
+		data, err := json.MarshalIndent(profileList{Profiles: profiles}, "", "  ")
+		if err != nil {
+			return fmt.Errorf("error marshaling JSON: %v", err)
+		}
+		fmt.Println(string(data))
+		return nil
+	case "yaml":
+		data, err := yaml.Marshal(profileList{Profiles: profiles})
+		if err != nil {
+			return fmt.Errorf("error marshaling YAML: %v", err)
+		}
+		fmt.Print(string(data))
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(w, "NAME\tSOURCE\tPRIVILEGED\tCAPABILITIES\tSECCOMP\tDESCRIPTION")
+	for _, p := range profiles {
+		containerContext, _ := cli.SecurityContexts(p.Name)
+
+		privileged := containerContext.Privileged != nil && *containerContext.Privileged
+		var caps []string
+		if c := containerContext.Capabilities; c != nil {
+			for _, add := range c.Add {
+				caps = append(caps, "+"+string(add))
+			}
+			for _, drop := range c.Drop {
+				caps = append(caps, "-"+string(drop))
+			}
+		}
+		seccomp := ""
+		if containerContext.SeccompProfile != nil {
+			seccomp = string(containerContext.SeccompProfile.Type)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%t\t%s\t%s\t%s\n", p.Name, p.Source, privileged, orNone(strings.Join(caps, ",")), orNone(seccomp), p.Description)
+	}
+	return w.Flush()
+}
+
+// Export functions for testing
+func SetProfileSources(file, configMap string) {
+	cli.SetProfileSources(file, configMap)
+}
+
+func LoadProfiles() error {
+	return cli.LoadProfiles(context.Background())
+}
+
+func ValidateProfileSelection() error {
+	return cli.ValidateProfileSelection()
+}
+
+func GetSecurityContextForProfile(name string) (*corev1.SecurityContext, *corev1.PodSecurityContext) {
+	return cli.SecurityContexts(name)
+}
@@ -1,74 +1,385 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
+	"net/url"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
 
+	"github.com/jbuet/kubectl-debug/debug"
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/remotecommand"
 )
 
-var (
-	namespace     string
-	podName       string
-	image         string
-	interactive   bool
-	tty           bool
-	removeAfter   bool
-	force         bool
-	cpuRequest    string
-	memoryLimit   string
-	memoryRequest string
-	profile       string
-	copyPod       bool
-)
+// cli is the Debugger the flags configure
+var cli = newDebugger()
+
+// overrideCommand holds the raw --override-command values
+var overrideCommand []string
+
+// CommandExitError carries the exit code of a command run with --, which
+// kubectl-debug exits with
+type CommandExitError = debug.CommandExitError
 
 var rootCmd = &cobra.Command{
-	Use:   "kubectl-debug",
+	Use:   "kubectl-debug [flags] [-- COMMAND [args...]]",
 	Short: "A tool for creating secure debug pods in Kubernetes",
 	Long: `kubectl-debug creates debug pods with secure defaults,
 including non-root execution, resource limits, and security context configuration.
 It provides an easy-to-use CLI interface for debugging Kubernetes pods.`,
 	SilenceErrors: true,
 	SilenceUsage:  true,
+	Args: func(cmd *cobra.Command, args []string) error {
+		// Only a command after -- is accepted, anything else is a mistyped subcommand
+		if dash := cmd.ArgsLenAtDash(); len(args) > 0 && dash != 0 {
+			return fmt.Errorf("unknown command %q for %q", args[0], cmd.CommandPath())
+		}
+		return nil
+	},
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		if err := cli.ResolveNamespace(); err != nil {
+			return err
+		}
+		// Defaults from the config file and the environment depend on the
+		// context and namespace
+		return applyConfig(cmd.Flags())
+	},
 	RunE: func(cmd *cobra.Command, args []string) error {
-		// Validate removeAfter flag
-		if removeAfter && !(interactive && tty) {
-			return fmt.Errorf("--rm requires -it")
+		// Everything after -- is the command to run in the debug container
+		if dash := cmd.ArgsLenAtDash(); dash >= 0 {
+			cli.Command = args[dash:]
 		}
 
-		// Validate profile
-		switch profile {
-		case "general", "restricted", "baseline", "privileged", "":
-			// Valid profiles
-		default:
-			return fmt.Errorf("invalid profile %q: must be one of: general, restricted, baseline, privileged", profile)
+		if err := validateDryRun(); err != nil {
+			return err
 		}
+		cli.DryRun = dryRun == "client"
 
-		return runDebug()
+		if err := validateResources(cmd.Flags()); err != nil {
+			return err
+		}
+		if err := validateToolkit(cmd.Flags()); err != nil {
+			return err
+		}
+		if err := parseOverrideCommand(); err != nil {
+			return err
+		}
+
+		return runDebug(cmd.Context())
 	},
 }
 
+// newDebugger returns the Debugger of the CLI
+func newDebugger() *debug.Debugger {
+	return debug.New(debug.DefaultOptions())
+}
+
+// validateResources checks the resource flags that conflict with --qos,
+// the values themselves are validated by the Debugger
+func validateResources(flags *pflag.FlagSet) error {
+	if cli.QoS == "besteffort" {
+		for _, name := range []string{"cpu-request", "cpu-limit", "memory-request", "memory-limit"} {
+			if flags.Changed(name) {
+				return fmt.Errorf("--%s cannot be used with --qos besteffort", name)
+			}
+		}
+	}
+	return nil
+}
+
+// validateToolkit checks --toolkit against --image. An image given on the
+// command line wins over a toolkit from the config file.
+func validateToolkit(flags *pflag.FlagSet) error {
+	if !flags.Changed("image") {
+		return nil
+	}
+	if flags.Changed("toolkit") {
+		return fmt.Errorf("--image cannot be used with --toolkit")
+	}
+	cli.Toolkit = ""
+	return nil
+}
+
+// parseOverrideCommand parses the NAME=COMMAND,ARG,... values of
+// --override-command
+func parseOverrideCommand() error {
+	cli.OverrideCommand = nil
+	for _, value := range overrideCommand {
+		name, command, ok := strings.Cut(value, "=")
+		if !ok || name == "" || command == "" {
+			return fmt.Errorf("invalid --override-command %q: must be NAME=COMMAND[,ARG...]", value)
+		}
+		if cli.OverrideCommand == nil {
+			cli.OverrideCommand = map[string][]string{}
+		}
+		cli.OverrideCommand[name] = strings.Split(command, ",")
+	}
+	return nil
+}
+
+// runDebug runs the session the flags describe and prints dry-run results
+func runDebug(ctx context.Context) error {
+	session, err := cli.Run(ctx)
+	if err != nil {
+		return err
+	}
+	if session != nil && session.DryRun != nil {
+		return printDryRun(session.DryRun)
+	}
+	return nil
+}
+
 func init() {
-	// Set namespace flag with default value
-	rootCmd.PersistentFlags().StringVarP(&namespace, "namespace", "n", "default", "namespace for the debug pod")
+	defaults := debug.DefaultOptions()
+
+	// Namespace defaults to the one configured in the current context
+	rootCmd.PersistentFlags().StringVarP(&cli.Namespace, "namespace", "n", "", "namespace for the debug pod (defaults to the context namespace)")
+
+	// Connection flags
+	rootCmd.PersistentFlags().StringVar(&cli.Kubeconfig, "kubeconfig", "", "path to the kubeconfig file to use for CLI requests")
+	rootCmd.PersistentFlags().StringVar(&cli.KubeContext, "context", "", "the name of the kubeconfig context to use")
+	rootCmd.PersistentFlags().StringVar(&cli.Cluster, "cluster", "", "the name of the kubeconfig cluster to use")
+	rootCmd.PersistentFlags().StringVar(&cli.User, "user", "", "the name of the kubeconfig user to use")
+	rootCmd.PersistentFlags().StringVar(&cli.Impersonate, "as", "", "username to impersonate for the operation")
+	rootCmd.PersistentFlags().StringArrayVar(&cli.ImpersonateGroups, "as-group", nil, "group to impersonate for the operation, this flag can be repeated to specify multiple groups")
+	rootCmd.PersistentFlags().StringVar(&cli.RequestTimeout, "request-timeout", defaults.RequestTimeout, "the length of time to wait before giving up on a single server request (e.g. 1s, 2m, 3h), zero means no timeout")
 
 	// Other flags
-	rootCmd.PersistentFlags().StringVarP(&podName, "pod", "p", "", "name of the target pod (optional)")
-	rootCmd.PersistentFlags().StringVar(&image, "image", "jbuet/debug:latest", "debug container image")
-	rootCmd.PersistentFlags().BoolVarP(&interactive, "stdin", "i", false, "keep stdin open even if not attached")
-	rootCmd.PersistentFlags().BoolVarP(&tty, "tty", "t", false, "allocate a TTY for the container")
-	rootCmd.PersistentFlags().BoolVar(&removeAfter, "rm", false, "automatically remove the pod after the session ends")
-	rootCmd.PersistentFlags().BoolVarP(&force, "force", "f", false, "force creation of a new debug pod if one already exists")
-	rootCmd.PersistentFlags().BoolVar(&copyPod, "copy", false, "create a copy of the target pod instead of adding a container")
+	rootCmd.PersistentFlags().StringVarP(&cli.Pod, "pod", "p", "", "target pod, a workload as deploy/NAME, sts/NAME, ds/NAME, job/NAME or svc/NAME, or node/NAME (optional)")
+	rootCmd.PersistentFlags().StringVarP(&cli.Container, "container", "c", "", "container of the target pod to debug (defaults to the kubectl.kubernetes.io/default-container annotation)")
+	rootCmd.PersistentFlags().StringVarP(&cli.Selector, "selector", "l", "", "label selector to choose the target pod (e.g. app=api)")
+	rootCmd.PersistentFlags().StringVar(&cli.Pick, "pick", "", "how to choose among pods matching --selector without prompting (first, random, newest, most-restarts)")
+	rootCmd.PersistentFlags().BoolVar(&cli.Unhealthy, "unhealthy", false, "when targeting a workload, pick its least healthy pod instead of a healthy one")
+	rootCmd.PersistentFlags().BoolVar(&cli.FanOut, "all", false, "run the command after -- in every running pod of the workload or --selector")
+	rootCmd.PersistentFlags().IntVar(&cli.Concurrency, "concurrency", defaults.Concurrency, "how many pods --all debugs at the same time")
+	rootCmd.PersistentFlags().StringVar(&cli.FanOutOutput, "all-output", defaults.FanOutOutput, "output of --all: lines prefixed with the pod name (prefix) or a JSON document per pod (json)")
+	rootCmd.PersistentFlags().StringVar(&cli.Image, "image", defaults.Image, "debug container image")
+	rootCmd.PersistentFlags().StringVar(&cli.Toolkit, "toolkit", "", "toolkit providing the image, default profile and command (net, proc, jvm, python, go, db or one listed by 'toolkits')")
+	rootCmd.PersistentFlags().BoolVarP(&cli.Interactive, "stdin", "i", false, "keep stdin open even if not attached")
+	rootCmd.PersistentFlags().BoolVarP(&cli.TTY, "tty", "t", false, "allocate a TTY for the container")
+	rootCmd.PersistentFlags().BoolVar(&cli.RemoveAfter, "rm", false, "automatically remove the pod after the session ends")
+	rootCmd.PersistentFlags().BoolVarP(&cli.Force, "force", "f", false, "force creation of a new debug pod if one already exists and skip confirmations")
+	rootCmd.PersistentFlags().BoolVar(&cli.Copy, "copy", false, "create a copy of the target pod instead of adding a container")
+	rootCmd.PersistentFlags().BoolVar(&cli.CrashLoop, "crashloop", false, "debug a copy of the target pod in which the restarting container is held idle instead of crashing, its command and environment are printed")
+	rootCmd.PersistentFlags().BoolVar(&cli.KeepServiceTraffic, "keep-service-traffic", false, "keep the labels Services select on the pod copy, so it receives their traffic")
+	rootCmd.PersistentFlags().StringToStringVar(&cli.SetImage, "set-image", nil, "with --copy or --crashloop, change container images of the copy as NAME=IMAGE, * for all containers (e.g. app=myapp:debug)")
+	rootCmd.PersistentFlags().StringArrayVar(&overrideCommand, "override-command", nil, "with --copy or --crashloop, replace the command of a container of the copy as NAME=COMMAND,ARG,... (e.g. app=sleep,infinity)")
+	rootCmd.PersistentFlags().DurationVar(&cli.TTL, "ttl", 0, "maximum lifetime of the debug pod (e.g. 2h), enforced with activeDeadlineSeconds")
+	rootCmd.PersistentFlags().DurationVar(&cli.WaitTimeout, "timeout", defaults.WaitTimeout, "how long to wait for the debug pod or container to start")
 
 	// Security profile flag
-	rootCmd.PersistentFlags().StringVar(&profile, "profile", "", "security profile to use (general, restricted, baseline, privileged)")
+	rootCmd.PersistentFlags().StringVar(&cli.Profile, "profile", "", "security profile to use (general, restricted, baseline, privileged or a profile listed by 'profiles')")
+	rootCmd.PersistentFlags().StringVar(&cli.ProfilesConfigMap, "profiles-configmap", defaults.ProfilesConfigMap, "NAMESPACE/NAME of a ConfigMap with additional security profiles")
 
 	// Resource flags
-	rootCmd.PersistentFlags().StringVar(&memoryLimit, "memory-limit", "128Mi", "memory limit for the debug container")
-	rootCmd.PersistentFlags().StringVar(&cpuRequest, "cpu-request", "100m", "CPU request for the debug container")
-	rootCmd.PersistentFlags().StringVar(&memoryRequest, "memory-request", "128Mi", "memory request for the debug container")
+	rootCmd.PersistentFlags().StringVar(&cli.MemoryLimit, "memory-limit", defaults.MemoryLimit, "memory limit for the debug container")
+	rootCmd.PersistentFlags().StringVar(&cli.CPURequest, "cpu-request", defaults.CPURequest, "CPU request for the debug container")
+	rootCmd.PersistentFlags().StringVar(&cli.MemoryRequest, "memory-request", defaults.MemoryRequest, "memory request for the debug container")
+	rootCmd.PersistentFlags().StringVar(&cli.CPULimit, "cpu-limit", "", "CPU limit for the debug container")
+	rootCmd.PersistentFlags().StringVar(&cli.EphemeralStorageRequest, "ephemeral-storage-request", "", "ephemeral storage request for the debug container")
+	rootCmd.PersistentFlags().StringVar(&cli.EphemeralStorageLimit, "ephemeral-storage-limit", "", "ephemeral storage limit for the debug container")
+	rootCmd.PersistentFlags().StringVar(&cli.QoS, "qos", "", "derive CPU and memory requests and limits for a QoS class (guaranteed, burstable, besteffort)")
+
+	// Dry-run flags
+	rootCmd.Flags().StringVar(&dryRun, "dry-run", "none", "print what would be created without touching the cluster (none, client)")
+	rootCmd.Flags().Lookup("dry-run").NoOptDefVal = "client"
+	rootCmd.Flags().StringVarP(&dryRunFormat, "output", "o", "yaml", "dry-run output format (yaml, json)")
 }
 
 func Execute() error {
-	return rootCmd.Execute()
+	// Interrupts cancel the session, which cleans up with --rm
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	return rootCmd.ExecuteContext(ctx)
+}
+
+// Export functions for testing
+func SetClientset(cs kubernetes.Interface) {
+	cli.SetClientset(cs)
+}
+
+func SetKubeContext(name string) {
+	cli.KubeContext = name
+}
+
+func SetPodName(name string) {
+	cli.Pod = name
+}
+
+func SetNamespace(ns string) {
+	cli.Namespace = ns
+}
+
+func SetImage(img string) {
+	cli.Image = img
+}
+
+func GetImage() string {
+	return cli.Image
+}
+
+func SetCopyPod(copy bool) {
+	cli.Copy = copy
+}
+
+func SetCrashLoop(value bool) {
+	cli.CrashLoop = value
+}
+
+func SetKeepServiceTraffic(value bool) {
+	cli.KeepServiceTraffic = value
+}
+
+// SetCopyChanges sets --set-image and parses --override-command values
+func SetCopyChanges(setImage map[string]string, overrides []string) error {
+	cli.SetImage = setImage
+	overrideCommand = overrides
+	return parseOverrideCommand()
+}
+
+func RunDebug() error {
+	return runDebug(context.Background())
+}
+
+func GetTargetContainerName() (string, error) {
+	return cli.GetTargetContainerName()
+}
+
+func GetTargetPodSecurityContext() (*corev1.PodSecurityContext, error) {
+	return cli.GetTargetPodSecurityContext()
+}
+
+func WaitForPod(podName string) error {
+	return cli.WaitForPod(podName)
+}
+
+func DeletePod(podName string) error {
+	return cli.DeletePod(podName)
+}
+
+func SetSessionExecutor(f func(config *rest.Config, sessionURL *url.URL) (remotecommand.Executor, error)) {
+	cli.SetSessionExecutor(f)
+}
+
+func AttachToPod(podName string) error {
+	return cli.AttachToPod(podName)
+}
+
+func SetContainer(name string) {
+	cli.Container = name
+}
+
+func SetUnhealthy(value bool) {
+	cli.Unhealthy = value
+}
+
+func ResolveTargetPod() (string, error) {
+	return cli.ResolveTargetPod()
+}
+
+func FindExistingDebugPod() (string, error) {
+	return cli.FindExistingDebugPod()
+}
+
+func GenerateUniqueName() string {
+	return cli.GenerateUniqueName()
+}
+
+func SetSession(stdin, allocateTTY, remove bool) {
+	cli.Interactive = stdin
+	cli.TTY = allocateTTY
+	cli.RemoveAfter = remove
+}
+
+type FanOutResult = debug.FanOutResult
+
+func SetFanOut(enabled bool, limit int, output string) {
+	cli.FanOut = enabled
+	cli.Concurrency = limit
+	cli.FanOutOutput = output
+}
+
+func ValidateFanOut() error {
+	return cli.ValidateFanOut()
+}
+
+func CheckPodSecurity(pod *corev1.Pod, level string) []string {
+	return debug.CheckPodSecurity(pod, level)
+}
+
+func GetProfile() string {
+	return cli.Profile
+}
+
+func RequiredAccess() []string {
+	return cli.RequiredAccess()
+}
+
+func SetResources(cpuReq, memoryReq, memoryLim string) {
+	cli.CPURequest = cpuReq
+	cli.MemoryRequest = memoryReq
+	cli.MemoryLimit = memoryLim
+}
+
+func SetExtraResources(cpuLim, storageReq, storageLim, qosClass string) {
+	cli.CPULimit = cpuLim
+	cli.EphemeralStorageRequest = storageReq
+	cli.EphemeralStorageLimit = storageLim
+	cli.QoS = qosClass
+}
+
+func ValidateResources() error {
+	if err := validateResources(pflag.NewFlagSet("test", pflag.ContinueOnError)); err != nil {
+		return err
+	}
+	_, err := cli.DebugResources()
+	return err
+}
+
+func DebugResources() (corev1.ResourceRequirements, error) {
+	return cli.DebugResources()
+}
+
+func PickPod(pods []corev1.Pod, strategy string) (*corev1.Pod, error) {
+	return debug.PickPod(pods, strategy)
+}
+
+func SetSelector(value string) {
+	cli.Selector = value
+}
+
+func SetPick(strategy string) {
+	cli.Pick = strategy
+}
+
+func SelectTargetPod() (string, error) {
+	return cli.SelectTargetPod()
+}
+
+func SetRunCommand(command []string) {
+	cli.Command = command
+}
+
+func SetWaitTimeout(d time.Duration) {
+	cli.WaitTimeout = d
+}
+
+func SetProfile(name string) {
+	cli.Profile = name
+}
+
+func SetForce(value bool) {
+	cli.Force = value
+}
+
+func SetNodeName(name string) {
+	cli.Node = name
 }
@@ -0,0 +1,70 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/jbuet/kubectl-debug/debug"
+	"github.com/spf13/cobra"
+	"sigs.k8s.io/yaml"
+)
+
+type toolkitList struct {
+	Toolkits []debug.Toolkit `json:"toolkits"`
+}
+
+var toolkitsCmd = &cobra.Command{
+	Use:   "toolkits",
+	Short: "List the toolkits available to --toolkit",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		switch outputFormat {
+		case "table", "json", "yaml":
+		default:
+			return fmt.Errorf("invalid output format %q: must be one of: table, json, yaml", outputFormat)
+		}
+		return printToolkits()
+	},
+}
+
+func init() {
+	toolkitsCmd.Flags().StringVarP(&outputFormat, "output", "o", "table", "output format (table, json, yaml)")
+	rootCmd.AddCommand(toolkitsCmd)
+}
+
+func printToolkits() error {
+	toolkits := cli.ToolkitCatalog()
+
+	switch outputFormat {
+	case "json":
+		data, err := json.MarshalIndent(toolkitList{Toolkits: toolkits}, "", "  ")
+		if err != nil {
+			return fmt.Errorf("error marshaling JSON: %v", err)
+		}
+		fmt.Println(string(data))
+		return nil
+	case "yaml":
+		data, err := yaml.Marshal(toolkitList{Toolkits: toolkits})
+		if err != nil {
+			return fmt.Errorf("error marshaling YAML: %v", err)
+		}
+		fmt.Print(string(data))
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(w, "NAME\tSOURCE\tIMAGES\tPROFILE\tCOMMAND\tDESCRIPTION")
+	for _, tk := range toolkits {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", tk.Name, tk.Source, strings.Join(tk.Images, ","),
+			orNone(tk.Profile), orNone(strings.Join(tk.Command, " ")), tk.Description)
+	}
+	return w.Flush()
+}
+
+// Export functions for testing
+func SetToolkit(name string, toolkits map[string]debug.Toolkit) {
+	cli.Toolkit = name
+	cli.Toolkits = toolkits
+}
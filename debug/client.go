@@ -0,0 +1,156 @@
+package debug
+
+import (
+	"context"
+	"fmt"
+
+	authenticationv1 "k8s.io/api/authentication/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// clientConfig resolves the kubeconfig honoring the connection flags.
+func (d *Debugger) clientConfig() clientcmd.ClientConfig {
+	loadingRules := clientcmd.NewDefaultClientConfigLoadingRules()
+	loadingRules.ExplicitPath = d.Kubeconfig
+
+	overrides := &clientcmd.ConfigOverrides{
+		CurrentContext: d.KubeContext,
+		Timeout:        d.RequestTimeout,
+	}
+	overrides.Context.Namespace = d.Namespace
+	overrides.Context.Cluster = d.Cluster
+	overrides.Context.AuthInfo = d.User
+	overrides.AuthInfo.Impersonate = d.Impersonate
+	overrides.AuthInfo.ImpersonateGroups = d.ImpersonateGroups
+
+	return clientcmd.NewNonInteractiveDeferredLoadingClientConfig(loadingRules, overrides)
+}
+
+// ContextName returns the kubeconfig context in use, empty without a kubeconfig
+func (d *Debugger) ContextName() (string, error) {
+	if d.KubeContext != "" {
+		return d.KubeContext, nil
+	}
+	raw, err := d.clientConfig().RawConfig()
+	if err != nil {
+		return "", fmt.Errorf("error loading kubeconfig: %v", err)
+	}
+	return raw.CurrentContext, nil
+}
+
+// ResolveNamespace falls back to the namespace of the selected context
+// when Namespace is not set.
+func (d *Debugger) ResolveNamespace() error {
+	if d.Namespace != "" {
+		return nil
+	}
+
+	ns, _, err := d.clientConfig().Namespace()
+	if clientcmd.IsEmptyConfig(err) {
+		// No kubeconfig at all, the client error will be reported later
+		ns, err = "default", nil
+	}
+	if err != nil {
+		return fmt.Errorf("error resolving namespace from kubeconfig: %v", err)
+	}
+	d.Namespace = ns
+	return nil
+}
+
+// getClient returns DebugOptions.Clientset or the client built from the
+// connection options on first use.
+func (d *Debugger) getClient() (kubernetes.Interface, error) {
+	if d.Clientset != nil {
+		return d.Clientset, nil
+	}
+	if d.clientset != nil {
+		return d.clientset, nil
+	}
+
+	config, err := d.clientConfig().ClientConfig()
+	if err != nil {
+		return nil, fmt.Errorf("error loading kubeconfig: %v", err)
+	}
+	cs, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return nil, fmt.Errorf("error creating kubernetes client: %v", err)
+	}
+	d.clientset = cs
+	return d.clientset, nil
+}
+
+// currentUser returns the name the API server knows the user by. It falls
+// back to the impersonated or kubeconfig user when SelfSubjectReview is not
+// available, and to an empty string when nothing is known.
+func (d *Debugger) currentUser(ctx context.Context) string {
+	if d.username != nil {
+		return *d.username
+	}
+
+	name := d.Impersonate
+	if client, err := d.getClient(); err == nil {
+		review, err := client.AuthenticationV1().SelfSubjectReviews().Create(ctx, &authenticationv1.SelfSubjectReview{}, metav1.CreateOptions{})
+		if err == nil && review.Status.UserInfo.Username != "" {
+			name = review.Status.UserInfo.Username
+		}
+	}
+	if name == "" {
+		if rawConfig, err := d.clientConfig().RawConfig(); err == nil {
+			contextName := rawConfig.CurrentContext
+			if d.KubeContext != "" {
+				contextName = d.KubeContext
+			}
+			if kubeCtx, ok := rawConfig.Contexts[contextName]; ok {
+				name = kubeCtx.AuthInfo
+			}
+			if d.User != "" {
+				name = d.User
+			}
+		}
+	}
+
+	d.username = &name
+	return name
+}
+
+// connectionArgs returns the kubectl flags that point it at the same
+// cluster, user and impersonation settings as the API client.
+func (d *Debugger) connectionArgs() []string {
+	var args []string
+	if d.Kubeconfig != "" {
+		args = append(args, "--kubeconfig="+d.Kubeconfig)
+	}
+	if d.KubeContext != "" {
+		args = append(args, "--context="+d.KubeContext)
+	}
+	if d.Cluster != "" {
+		args = append(args, "--cluster="+d.Cluster)
+	}
+	if d.User != "" {
+		args = append(args, "--user="+d.User)
+	}
+	if d.Impersonate != "" {
+		args = append(args, "--as="+d.Impersonate)
+	}
+	for _, group := range d.ImpersonateGroups {
+		args = append(args, "--as-group="+group)
+	}
+	if d.RequestTimeout != "" && d.RequestTimeout != "0" {
+		args = append(args, "--request-timeout="+d.RequestTimeout)
+	}
+	return args
+}
+
+// kubectlArgv returns the full kubectl command line, connection flags included.
+func (d *Debugger) kubectlArgv(args ...string) []string {
+	return append(append([]string{"kubectl"}, d.connectionArgs()...), args...)
+}
+
+// Export functions for testing
+func (d *Debugger) SetClientset(cs kubernetes.Interface) {
+	d.Clientset = cs
+	d.clientset = nil
+	d.username = nil
+}
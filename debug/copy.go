@@ -0,0 +1,184 @@
+package debug
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/pointer"
+)
+
+// validateCopyChanges checks SetImage and OverrideCommand against the
+// containers of the target pod
+func (d *Debugger) validateCopyChanges(targetPod *corev1.Pod) error {
+	names := map[string]bool{}
+	var available []string
+	for _, c := range targetPod.Spec.Containers {
+		names[c.Name] = true
+		available = append(available, c.Name)
+	}
+
+	var unknown []string
+	for name := range d.SetImage {
+		if name != "*" && !names[name] {
+			unknown = append(unknown, name)
+		}
+	}
+	for name := range d.OverrideCommand {
+		if !names[name] {
+			unknown = append(unknown, name)
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return fmt.Errorf("container(s) %s not found in pod %s, available containers: %s",
+			strings.Join(unknown, ", "), targetPod.Name, strings.Join(available, ", "))
+	}
+	if _, ok := d.OverrideCommand[d.Container]; ok && d.CrashLoop {
+		return fmt.Errorf("--override-command cannot change container %s, which --crashloop holds", d.Container)
+	}
+	return nil
+}
+
+// buildPodCopy generates the pod copy: the target pod's spec with
+// SetImage and OverrideCommand applied and probes removed, and the
+// debugger container added, sharing the process namespace. With CrashLoop
+// the target container is held and its volumes are mounted in the debugger.
+func (d *Debugger) buildPodCopy(ctx context.Context, targetPod *corev1.Pod, target *corev1.Container) (*corev1.Pod, error) {
+	if err := d.validateCopyChanges(targetPod); err != nil {
+		return nil, err
+	}
+	resources, err := d.debugResources()
+	if err != nil {
+		return nil, err
+	}
+	debugContext := d.debuggerSecurityContext(targetPod, target)
+
+	// Without the labels its controllers and Services select, the copy is
+	// neither adopted nor sent traffic
+	podLabels, err := d.targetLabels(ctx, targetPod)
+	if err != nil {
+		d.logf("Warning: Could not read the selectors of target pod labels, not copying them: %v", err)
+		podLabels = map[string]string{}
+	}
+	podLabels["debug-tool/type"] = "debug-pod"
+	podLabels["debug-tool/target"] = d.Pod
+	podLabels[modeLabel] = ModeCopy
+
+	spec := targetPod.Spec.DeepCopy()
+	// The copy is scheduled anew, without the target's debug containers
+	spec.NodeName = ""
+	spec.EphemeralContainers = nil
+	spec.ShareProcessNamespace = pointer.Bool(true)
+
+	debugger := corev1.Container{
+		Name:                     "debugger",
+		Image:                    d.Image,
+		Env:                      d.sessionEnv(ctx, d.Pod),
+		Resources:                resources,
+		TerminationMessagePolicy: corev1.TerminationMessageFallbackToLogsOnError,
+	}
+
+	for i := range spec.Containers {
+		c := &spec.Containers[i]
+		// Probes would restart or hide the copy while it is investigated
+		c.LivenessProbe = nil
+		c.ReadinessProbe = nil
+		c.StartupProbe = nil
+
+		if image, ok := d.SetImage[c.Name]; ok {
+			c.Image = image
+		} else if image, ok := d.SetImage["*"]; ok {
+			c.Image = image
+		}
+		if command, ok := d.OverrideCommand[c.Name]; ok {
+			c.Command = append([]string(nil), command...)
+			c.Args = nil
+		}
+		if d.CrashLoop && c.Name == target.Name {
+			holdContainer(c, &debugger)
+		}
+	}
+	if !reflect.DeepEqual(debugContext, &corev1.SecurityContext{}) {
+		debugger.SecurityContext = debugContext
+	}
+	if d.Interactive && d.TTY && !d.isRunMode() {
+		debugger.Command = d.sessionCommand()
+		debugger.Stdin = true
+		debugger.TTY = true
+	} else {
+		// Commands and later sessions are run with kubectl exec
+		debugger.Command = keepAliveCommand
+	}
+	spec.Containers = append(spec.Containers, debugger)
+
+	podCopy := &corev1.Pod{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: "v1",
+			Kind:       "Pod",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      d.generateUniqueName(),
+			Namespace: d.Namespace,
+			Labels:    podLabels,
+			// kubectl exec and logs default to the debugger
+			Annotations: map[string]string{defaultContainerAnnotation: "debugger"},
+		},
+		Spec: *spec,
+	}
+
+	// Record the TTL and let the kubelet stop the copy once it expires
+	if d.TTL > 0 {
+		for key, value := range d.ttlAnnotations() {
+			podCopy.Annotations[key] = value
+		}
+		podCopy.Spec.ActiveDeadlineSeconds = pointer.Int64(int64(d.TTL.Seconds()))
+	}
+	return podCopy, nil
+}
+
+// createPodCopy creates a copy of the target pod with the debugger container
+func (d *Debugger) createPodCopy(ctx context.Context, targetPod *corev1.Pod, target *corev1.Container) (*Session, error) {
+	podCopy, err := d.buildPodCopy(ctx, targetPod, target)
+	if err != nil {
+		return nil, newExecError("%v", err)
+	}
+	if err := d.checkNamespaceResources(ctx, podCopy, "debugger"); err != nil {
+		return nil, newExecError("%v", err)
+	}
+	if d.CrashLoop {
+		d.printEntrypoint(ctx, target)
+	}
+
+	if d.DryRun {
+		result := &DryRunResult{Pod: podCopy}
+		if d.isRunMode() {
+			result.Command = d.kubectlArgv(d.runCommandArgs(podCopy.Name, "debugger")...)
+		} else if d.Interactive && d.TTY {
+			result.Command = d.kubectlArgv(d.attachArgs(podCopy.Name, "debugger")...)
+		}
+		return &Session{DryRun: result}, nil
+	}
+
+	client, err := d.getClient()
+	if err != nil {
+		return nil, newExecError("%v", err)
+	}
+	d.logf("Creating debug pod %s as a copy of %s (targeting container %s)...\n", podCopy.Name, d.Pod, target.Name)
+	if _, err := client.CoreV1().Pods(d.Namespace).Create(ctx, podCopy, metav1.CreateOptions{}); err != nil {
+		return nil, newExecError("failed to create debug pod: %v", explainAdmissionError("pod copy", err))
+	}
+	session := d.newSession(ModeCopy, podCopy.Name, "debugger")
+
+	if d.attaches() {
+		d.logf("Waiting for container debugger to start...")
+		if err := d.waitForContainer(ctx, podCopy.Name, "debugger"); err != nil {
+			return session, newExecError("debug container did not start: %v", err)
+		}
+	}
+	return session, nil
+}
@@ -0,0 +1,152 @@
+package debug
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// copies reports whether the session debugs a copy of the target pod
+func (d *Debugger) copies() bool {
+	return d.Copy || d.CrashLoop
+}
+
+func (d *Debugger) validateCrashLoop() error {
+	if !d.CrashLoop {
+		return nil
+	}
+	if d.Pod == "" && d.Selector == "" {
+		return fmt.Errorf("--crashloop requires a target pod in --pod or a --selector")
+	}
+	if kind, _, err := parseTargetRef(d.Pod); err == nil && kind == "Node" {
+		return fmt.Errorf("--crashloop cannot be used with a node target")
+	}
+	return nil
+}
+
+// containerRestarting reports whether a container of the pod has restarted
+// or is waiting in CrashLoopBackOff
+func containerRestarting(pod *corev1.Pod, name string) bool {
+	for _, status := range pod.Status.ContainerStatuses {
+		if status.Name != name {
+			continue
+		}
+		waiting := status.State.Waiting
+		return status.RestartCount > 0 || (waiting != nil && waiting.Reason == "CrashLoopBackOff")
+	}
+	return false
+}
+
+// restartingContainer returns the container of the pod in CrashLoopBackOff,
+// or the one with the most restarts, nil when none is restarting
+func restartingContainer(pod *corev1.Pod) *corev1.Container {
+	var chosen string
+	var restarts int32
+	for _, status := range pod.Status.ContainerStatuses {
+		if waiting := status.State.Waiting; waiting != nil && waiting.Reason == "CrashLoopBackOff" {
+			chosen = status.Name
+			break
+		}
+		if status.RestartCount > restarts {
+			chosen, restarts = status.Name, status.RestartCount
+		}
+	}
+	for i := range pod.Spec.Containers {
+		if pod.Spec.Containers[i].Name == chosen {
+			return &pod.Spec.Containers[i]
+		}
+	}
+	return nil
+}
+
+// holdContainer replaces the entrypoint of the crashing container of the
+// copy with an idle process and gives the debugger its volumes
+func holdContainer(c, debugger *corev1.Container) {
+	c.Command = append([]string(nil), keepAliveCommand...)
+	c.Args = nil
+	for _, mount := range c.VolumeMounts {
+		debugger.VolumeMounts = append(debugger.VolumeMounts, *mount.DeepCopy())
+	}
+	debugger.VolumeDevices = append(debugger.VolumeDevices, c.VolumeDevices...)
+}
+
+// printEntrypoint logs the original command and environment of the held
+// container, to be run by hand from the debugger
+func (d *Debugger) printEntrypoint(ctx context.Context, target *corev1.Container) {
+	command := shellJoin(append(append([]string(nil), target.Command...), target.Args...))
+	if len(target.Command) == 0 {
+		// The entrypoint comes from the image, which only its registry knows
+		config, err := readImageConfig(ctx, target.Image)
+		switch {
+		case err != nil:
+			d.logf("Warning: Could not read the entrypoint of %s: %v", target.Image, err)
+			command = strings.TrimSpace("<entrypoint of " + target.Image + "> " + command)
+		case len(target.Args) > 0:
+			command = shellJoin(append(append([]string(nil), config.Entrypoint...), target.Args...))
+		default:
+			command = shellJoin(append(append([]string(nil), config.Entrypoint...), config.Cmd...))
+		}
+	}
+
+	d.logf("Container %s is held by %s in the copy, its original command is:", target.Name, strings.Join(keepAliveCommand, " "))
+	d.logf("  %s", command)
+	if len(target.Env) > 0 || len(target.EnvFrom) > 0 {
+		d.logf("and its environment:")
+		for _, env := range target.Env {
+			d.logf("  %s", describeEnvVar(env))
+		}
+		for _, source := range target.EnvFrom {
+			d.logf("  %s", describeEnvFrom(source))
+		}
+	}
+	d.logf("Its filesystem is under /proc/<PID of %s>/root in the debugger container", keepAliveCommand[0])
+}
+
+func describeEnvVar(env corev1.EnvVar) string {
+	from := env.ValueFrom
+	switch {
+	case from == nil:
+		return env.Name + "=" + shellJoin([]string{env.Value})
+	case from.SecretKeyRef != nil:
+		return fmt.Sprintf("%s from key %s of secret %s", env.Name, from.SecretKeyRef.Key, from.SecretKeyRef.Name)
+	case from.ConfigMapKeyRef != nil:
+		return fmt.Sprintf("%s from key %s of configmap %s", env.Name, from.ConfigMapKeyRef.Key, from.ConfigMapKeyRef.Name)
+	case from.FieldRef != nil:
+		return fmt.Sprintf("%s from field %s", env.Name, from.FieldRef.FieldPath)
+	case from.ResourceFieldRef != nil:
+		return fmt.Sprintf("%s from resource %s", env.Name, from.ResourceFieldRef.Resource)
+	}
+	return env.Name
+}
+
+func describeEnvFrom(source corev1.EnvFromSource) string {
+	prefix := ""
+	if source.Prefix != "" {
+		prefix = fmt.Sprintf(", prefixed with %s", source.Prefix)
+	}
+	if source.SecretRef != nil {
+		return fmt.Sprintf("all keys of secret %s%s", source.SecretRef.Name, prefix)
+	}
+	if source.ConfigMapRef != nil {
+		return fmt.Sprintf("all keys of configmap %s%s", source.ConfigMapRef.Name, prefix)
+	}
+	return ""
+}
+
+var shellSafe = regexp.MustCompile(`^[A-Za-z0-9_@%+=:,./-]+$`)
+
+// shellJoin joins arguments into a command line a shell splits back into them
+func shellJoin(args []string) string {
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		if shellSafe.MatchString(arg) {
+			quoted[i] = arg
+			continue
+		}
+		quoted[i] = "'" + strings.ReplaceAll(arg, "'", `'\''`) + "'"
+	}
+	return strings.Join(quoted, " ")
+}
@@ -0,0 +1,859 @@
+package debug
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"math/rand"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/utils/pointer"
+)
+
+// Annotation kubectl uses to pick the default container of a pod
+const defaultContainerAnnotation = "kubectl.kubernetes.io/default-container"
+
+// Tipo de error para errores de ejecución
+type ExecError struct {
+	msg string
+}
+
+func (e *ExecError) Error() string {
+	return e.msg
+}
+
+func newExecError(format string, args ...interface{}) *ExecError {
+	return &ExecError{
+		msg: fmt.Sprintf(format, args...),
+	}
+}
+
+func (d *Debugger) findExistingDebugPod(ctx context.Context) (string, error) {
+	client, err := d.getClient()
+	if err != nil {
+		return "", err
+	}
+
+	labelSelector := "debug-tool/type=debug-pod"
+	if d.Pod != "" {
+		labelSelector += fmt.Sprintf(",debug-tool/target=%s", d.Pod)
+	}
+
+	pods, err := client.CoreV1().Pods(d.Namespace).List(ctx, metav1.ListOptions{LabelSelector: labelSelector})
+	if err != nil {
+		return "", fmt.Errorf("error checking for existing pods: %v", err)
+	}
+
+	// Use the first pod found
+	if len(pods.Items) == 0 {
+		return "", nil
+	}
+	return pods.Items[0].Name, nil
+}
+
+func (d *Debugger) askForNewPod(existingPod string) bool {
+	if d.Force {
+		return true
+	}
+
+	fmt.Printf("Debug pod '%s' already exists in namespace '%s'. Do you want to:\n", existingPod, d.Namespace)
+	fmt.Printf("[1] Use existing pod\n")
+	fmt.Printf("[2] Create new pod\n")
+	fmt.Printf("Choose (1/2) [1]: ")
+
+	reader := bufio.NewReader(os.Stdin)
+	response, err := reader.ReadString('\n')
+	if err != nil {
+		return false
+	}
+
+	response = strings.TrimSpace(response)
+	return response == "2"
+}
+
+func (d *Debugger) generateUniqueName() string {
+	timestamp := time.Now().Format("150405") // HHMMSS
+	randomStr := fmt.Sprintf("%04d", rand.Intn(10000))
+
+	// Node debug pods include the node name
+	if d.Node != "" {
+		return fmt.Sprintf("debug-node-%s-%s-%s", d.Node, timestamp, randomStr)
+	}
+
+	// If no target pod, use simpler name format
+	if d.Pod == "" {
+		return fmt.Sprintf("debug-%s-%s", timestamp, randomStr)
+	}
+
+	// If target pod specified, include it in the name
+	return fmt.Sprintf("debug-%s-%s-%s", d.Pod, timestamp, randomStr)
+}
+
+// debugTarget describes what a debug pod is debugging
+func (d *Debugger) debugTarget() string {
+	if d.Node != "" {
+		return "node/" + d.Node
+	}
+	return d.Pod
+}
+
+// attachToPod starts a shell in the debugger container of a debug pod
+func (d *Debugger) attachToPod(ctx context.Context, debugPodName string) error {
+	req := streamRequest{
+		pod:       debugPodName,
+		container: "debugger",
+		command:   []string{"sh"},
+		stdin:     os.Stdin,
+		stdout:    os.Stdout,
+		stderr:    os.Stderr,
+		tty:       true,
+	}
+	return d.stream(ctx, req)
+}
+
+func (d *Debugger) deletePod(ctx context.Context, debugPodName string) error {
+	client, err := d.getClient()
+	if err != nil {
+		return err
+	}
+
+	if err := client.CoreV1().Pods(d.Namespace).Delete(ctx, debugPodName, metav1.DeleteOptions{}); err != nil {
+		return fmt.Errorf("error deleting pod %s: %v", debugPodName, err)
+	}
+	d.logf("Pod %s deleted", debugPodName)
+	return nil
+}
+
+func (d *Debugger) getTargetPod(ctx context.Context) (*corev1.Pod, error) {
+	client, err := d.getClient()
+	if err != nil {
+		return nil, err
+	}
+	return client.CoreV1().Pods(d.Namespace).Get(ctx, d.Pod, metav1.GetOptions{})
+}
+
+// workloadKinds maps the accepted --pod prefixes to a workload kind
+var workloadKinds = map[string]string{
+	"po":           "Pod",
+	"pod":          "Pod",
+	"pods":         "Pod",
+	"deploy":       "Deployment",
+	"deployment":   "Deployment",
+	"deployments":  "Deployment",
+	"sts":          "StatefulSet",
+	"statefulset":  "StatefulSet",
+	"statefulsets": "StatefulSet",
+	"ds":           "DaemonSet",
+	"daemonset":    "DaemonSet",
+	"daemonsets":   "DaemonSet",
+	"job":          "Job",
+	"jobs":         "Job",
+	"svc":          "Service",
+	"service":      "Service",
+	"services":     "Service",
+	"no":           "Node",
+	"node":         "Node",
+	"nodes":        "Node",
+}
+
+// parseTargetRef splits a kind/name reference such as deploy/api
+func parseTargetRef(ref string) (string, string, error) {
+	prefix, name, found := strings.Cut(ref, "/")
+	if !found {
+		return "Pod", ref, nil
+	}
+
+	kind, ok := workloadKinds[strings.ToLower(prefix)]
+	if !ok {
+		return "", "", fmt.Errorf("unsupported target type %q: must be one of pod, deploy, sts, ds, job, svc, node", prefix)
+	}
+	if name == "" {
+		return "", "", fmt.Errorf("missing name in target %q", ref)
+	}
+	return kind, name, nil
+}
+
+// getWorkloadPods returns the pods that back the given workload. Pods are
+// matched by the workload selector and, for controllers, by owner reference.
+func (d *Debugger) getWorkloadPods(ctx context.Context, kind, name string) ([]corev1.Pod, error) {
+	client, err := d.getClient()
+	if err != nil {
+		return nil, err
+	}
+
+	var selector *metav1.LabelSelector
+	owners := map[types.UID]bool{}
+
+	switch kind {
+	case "Deployment":
+		deployment, err := client.AppsV1().Deployments(d.Namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("error getting deployment %s: %v", name, err)
+		}
+		selector = deployment.Spec.Selector
+
+		// Pods are owned by the deployment's ReplicaSets
+		replicaSets, err := client.AppsV1().ReplicaSets(d.Namespace).List(ctx, metav1.ListOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("error listing replicasets: %v", err)
+		}
+		for _, rs := range replicaSets.Items {
+			if ref := metav1.GetControllerOf(&rs); ref != nil && ref.UID == deployment.UID {
+				owners[rs.UID] = true
+			}
+		}
+
+	case "StatefulSet":
+		statefulSet, err := client.AppsV1().StatefulSets(d.Namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("error getting statefulset %s: %v", name, err)
+		}
+		selector = statefulSet.Spec.Selector
+		owners[statefulSet.UID] = true
+
+	case "DaemonSet":
+		daemonSet, err := client.AppsV1().DaemonSets(d.Namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("error getting daemonset %s: %v", name, err)
+		}
+		selector = daemonSet.Spec.Selector
+		owners[daemonSet.UID] = true
+
+	case "Job":
+		job, err := client.BatchV1().Jobs(d.Namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("error getting job %s: %v", name, err)
+		}
+		selector = job.Spec.Selector
+		owners[job.UID] = true
+
+	case "Service":
+		service, err := client.CoreV1().Services(d.Namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("error getting service %s: %v", name, err)
+		}
+		if len(service.Spec.Selector) == 0 {
+			return nil, fmt.Errorf("service %s has no selector", name)
+		}
+		selector = &metav1.LabelSelector{MatchLabels: service.Spec.Selector}
+
+	default:
+		return nil, fmt.Errorf("unsupported workload kind %s", kind)
+	}
+
+	if selector == nil {
+		return nil, fmt.Errorf("%s %s has no selector", strings.ToLower(kind), name)
+	}
+	labelSelector, err := metav1.LabelSelectorAsSelector(selector)
+	if err != nil {
+		return nil, fmt.Errorf("invalid selector on %s %s: %v", strings.ToLower(kind), name, err)
+	}
+
+	pods, err := client.CoreV1().Pods(d.Namespace).List(ctx, metav1.ListOptions{LabelSelector: labelSelector.String()})
+	if err != nil {
+		return nil, fmt.Errorf("error listing pods for %s %s: %v", strings.ToLower(kind), name, err)
+	}
+
+	var result []corev1.Pod
+	for _, pod := range pods.Items {
+		if len(owners) > 0 {
+			ref := metav1.GetControllerOf(&pod)
+			if ref == nil || !owners[ref.UID] {
+				continue
+			}
+		}
+		result = append(result, pod)
+	}
+	return result, nil
+}
+
+// podHealthScore ranks a pod: ready pods first, then running ones, and
+// fewer restarts are better. Pods being deleted always rank last.
+func podHealthScore(pod *corev1.Pod) int {
+	if pod.DeletionTimestamp != nil {
+		return -1 << 30
+	}
+
+	score := 0
+	if pod.Status.Phase == corev1.PodRunning {
+		score += 1 << 20
+	}
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == corev1.PodReady && condition.Status == corev1.ConditionTrue {
+			score += 1 << 21
+		}
+	}
+	return score - int(podRestarts(pod))
+}
+
+// podRestarts sums the restart count of every container in the pod
+func podRestarts(pod *corev1.Pod) int32 {
+	var restarts int32
+	for _, status := range pod.Status.ContainerStatuses {
+		restarts += status.RestartCount
+	}
+	return restarts
+}
+
+// resolveTargetPod turns a workload reference in --pod into the name of
+// one of its pods: the healthiest one, or the least healthy with --unhealthy.
+// A node/NAME reference clears podName and sets nodeName instead.
+func (d *Debugger) resolveTargetPod(ctx context.Context) error {
+	kind, name, err := parseTargetRef(d.Pod)
+	if err != nil {
+		return err
+	}
+	if kind == "Pod" {
+		d.Pod = name
+		return nil
+	}
+
+	// Nodes are debugged with a standalone pod pinned to them
+	if kind == "Node" {
+		d.Node = name
+		d.Pod = ""
+		return nil
+	}
+
+	pods, err := d.getWorkloadPods(ctx, kind, name)
+	if err != nil {
+		return err
+	}
+	if len(pods) == 0 {
+		return fmt.Errorf("no pods found for %s in namespace %s", d.Pod, d.Namespace)
+	}
+
+	sort.SliceStable(pods, func(i, j int) bool {
+		// A crashing container is looked for in the least healthy pod
+		if d.Unhealthy || d.CrashLoop {
+			return podHealthScore(&pods[i]) < podHealthScore(&pods[j])
+		}
+		return podHealthScore(&pods[i]) > podHealthScore(&pods[j])
+	})
+
+	d.logf("Resolved %s to pod %s", d.Pod, pods[0].Name)
+	d.Pod = pods[0].Name
+	return nil
+}
+
+func (d *Debugger) getTargetPodSecurityContext(ctx context.Context) (*corev1.PodSecurityContext, error) {
+	pod, err := d.getTargetPod(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error getting pod info: %v", err)
+	}
+
+	return pod.Spec.SecurityContext, nil
+}
+
+// SecurityContexts returns the container and pod security contexts of a
+// profile, user-defined profiles need LoadProfiles first
+func (d *Debugger) SecurityContexts(profileName string) (*corev1.SecurityContext, *corev1.PodSecurityContext) {
+	// User-defined profiles loaded from the profiles file or ConfigMap
+	if !isBuiltinProfile(profileName) {
+		if p, ok := d.lookupProfile(profileName); ok {
+			return customProfileContexts(p)
+		}
+	}
+
+	containerContext := &corev1.SecurityContext{
+		SeccompProfile: &corev1.SeccompProfile{
+			Type: corev1.SeccompProfileTypeRuntimeDefault,
+		},
+	}
+
+	podContext := &corev1.PodSecurityContext{
+		SeccompProfile: &corev1.SeccompProfile{
+			Type: corev1.SeccompProfileTypeRuntimeDefault,
+		},
+	}
+
+	switch profileName {
+	case "restricted":
+		containerContext.AllowPrivilegeEscalation = pointer.Bool(false)
+		containerContext.Capabilities = &corev1.Capabilities{
+			Drop: []corev1.Capability{"ALL"},
+		}
+		containerContext.RunAsNonRoot = pointer.Bool(true)
+		containerContext.RunAsUser = pointer.Int64(1000)
+		containerContext.SeccompProfile.Type = corev1.SeccompProfileTypeRuntimeDefault
+
+		podContext.RunAsNonRoot = pointer.Bool(true)
+		podContext.RunAsUser = pointer.Int64(1000)
+		podContext.SeccompProfile.Type = corev1.SeccompProfileTypeRuntimeDefault
+
+	case "baseline":
+		containerContext.AllowPrivilegeEscalation = pointer.Bool(false)
+		containerContext.Capabilities = &corev1.Capabilities{
+			Drop: []corev1.Capability{"ALL"},
+		}
+		containerContext.SeccompProfile.Type = corev1.SeccompProfileTypeRuntimeDefault
+
+		podContext.SeccompProfile.Type = corev1.SeccompProfileTypeRuntimeDefault
+
+	case "privileged":
+		containerContext.AllowPrivilegeEscalation = pointer.Bool(true)
+		containerContext.Privileged = pointer.Bool(true)
+		containerContext.Capabilities = &corev1.Capabilities{
+			Add: []corev1.Capability{"ALL"},
+		}
+		containerContext.SeccompProfile.Type = corev1.SeccompProfileTypeUnconfined
+
+		podContext.SeccompProfile.Type = corev1.SeccompProfileTypeUnconfined
+	}
+
+	return containerContext, podContext
+}
+
+// buildDebugPod generates the standalone debug pod manifest
+func (d *Debugger) buildDebugPod(ctx context.Context) (*corev1.Pod, error) {
+	debugPodName := d.generateUniqueName()
+	d.logf("Generating debug pod name: %s", debugPodName)
+
+	// Initialize basic labels
+	labels := map[string]string{
+		"debug-tool/type": "debug-pod",
+	}
+
+	// Configure pod spec
+	automountServiceAccountToken := false
+	podSpec := corev1.PodSpec{
+		AutomountServiceAccountToken:  &automountServiceAccountToken,
+		TerminationGracePeriodSeconds: pointer.Int64(0),
+	}
+
+	// If targeting an existing pod
+	if d.Pod != "" {
+		// Try to get target pod's security context
+		secContext, err := d.getTargetPodSecurityContext(ctx)
+		if err != nil {
+			d.logf("Warning: Could not get target pod security context: %v", err)
+		} else if secContext != nil && secContext.RunAsUser != nil {
+			// Only set security context if target pod has RunAsUser defined
+			podSpec.SecurityContext = secContext
+			d.logf("Using security context from target pod (UID: %d)", *secContext.RunAsUser)
+		} else {
+			d.logf("No security context defined in target pod, using profile settings")
+		}
+
+		// Keep the target pod's labels its controllers and Services do not select
+		if targetPod, err := d.getTargetPod(ctx); err != nil {
+			d.logf("Warning: Could not get target pod labels: %v", err)
+		} else if targetLabels, err := d.targetLabels(ctx, targetPod); err != nil {
+			d.logf("Warning: Could not read the selectors of target pod labels, not copying them: %v", err)
+		} else {
+			labels = targetLabels
+		}
+		labels["debug-tool/target"] = d.Pod
+
+		// Enable process namespace sharing
+		shareProcessNamespace := true
+		podSpec.ShareProcessNamespace = &shareProcessNamespace
+	}
+
+	// If no security context is set from target pod, use profile settings
+	if podSpec.SecurityContext == nil {
+		_, podContext := d.SecurityContexts(d.Profile)
+		podSpec.SecurityContext = podContext
+		d.logf("Using security context from profile: %s", d.Profile)
+	}
+
+	// Ensure debug tool labels are present
+	labels["debug-tool/type"] = "debug-pod"
+
+	debugPod := &corev1.Pod{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: "v1",
+			Kind:       "Pod",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      debugPodName,
+			Namespace: d.Namespace,
+			Labels:    labels,
+		},
+		Spec: podSpec,
+	}
+
+	// Add the debug container with appropriate security context
+	containerContext, _ := d.SecurityContexts(d.Profile)
+	if podSpec.SecurityContext != nil && podSpec.SecurityContext.RunAsUser != nil {
+		// If pod has a specific RunAsUser, override the container's RunAsUser
+		containerContext.RunAsUser = podSpec.SecurityContext.RunAsUser
+		containerContext.RunAsNonRoot = podSpec.SecurityContext.RunAsNonRoot
+	}
+
+	resources, err := d.debugResources()
+	if err != nil {
+		return nil, err
+	}
+
+	// Add the debug container
+	var command []string
+	if d.Interactive && d.TTY && !d.isRunMode() {
+		command = d.sessionCommand()
+		if command == nil {
+			command = []string{"bash"}
+		}
+	} else {
+		command = keepAliveCommand
+	}
+
+	debugPod.Spec.Containers = []corev1.Container{
+		{
+			Name:            "debugger",
+			Image:           d.Image,
+			Command:         command,
+			Env:             d.sessionEnv(ctx, d.debugTarget()),
+			Stdin:           true,
+			TTY:             true,
+			SecurityContext: containerContext,
+			Resources:       resources,
+			LivenessProbe: &corev1.Probe{
+				ProbeHandler: corev1.ProbeHandler{
+					Exec: &corev1.ExecAction{
+						Command: []string{"/bin/true"},
+					},
+				},
+				InitialDelaySeconds: 5,
+				PeriodSeconds:       10,
+			},
+			ReadinessProbe: &corev1.Probe{
+				ProbeHandler: corev1.ProbeHandler{
+					Exec: &corev1.ExecAction{
+						Command: []string{"/bin/true"},
+					},
+				},
+				InitialDelaySeconds: 5,
+				PeriodSeconds:       10,
+			},
+		},
+	}
+
+	// Record the TTL and let the kubelet stop the pod once it expires
+	if d.TTL > 0 {
+		debugPod.Annotations = d.ttlAnnotations()
+		debugPod.Spec.ActiveDeadlineSeconds = pointer.Int64(int64(d.TTL.Seconds()))
+	}
+
+	if d.Node != "" {
+		d.applyNodeDebugSpec(debugPod)
+		d.logf("Debug pod will run on node %s with the host root filesystem at %s", d.Node, hostRootMountPath)
+	}
+
+	return debugPod, nil
+}
+
+func (d *Debugger) createDebugPod(ctx context.Context) (string, error) {
+	client, err := d.getClient()
+	if err != nil {
+		return "", err
+	}
+
+	debugPod, err := d.buildDebugPod(ctx)
+	if err != nil {
+		return "", err
+	}
+	if err := d.checkNamespaceResources(ctx, debugPod, "debugger"); err != nil {
+		return "", err
+	}
+
+	d.logf("Creating debug pod...")
+	if _, err := client.CoreV1().Pods(d.Namespace).Create(ctx, debugPod, metav1.CreateOptions{}); err != nil {
+		return "", fmt.Errorf("error creating debug pod: %v", explainAdmissionError("debug pod", err))
+	}
+
+	d.logf("Debug pod created successfully")
+	return debugPod.Name, nil
+}
+
+// chooseTargetContainer returns the container selected with --container,
+// the one named by the default-container annotation, or asks the user when
+// the pod has several containers. The choice is remembered in targetContainer.
+func (d *Debugger) chooseTargetContainer(pod *corev1.Pod) (*corev1.Container, error) {
+	containers := pod.Spec.Containers
+	if len(containers) == 0 {
+		return nil, fmt.Errorf("pod %s has no containers", pod.Name)
+	}
+
+	find := func(name string) *corev1.Container {
+		for i := range containers {
+			if containers[i].Name == name {
+				return &containers[i]
+			}
+		}
+		return nil
+	}
+
+	if d.Container != "" {
+		if c := find(d.Container); c != nil {
+			return c, nil
+		}
+		names := make([]string, 0, len(containers))
+		for _, c := range containers {
+			names = append(names, c.Name)
+		}
+		return nil, fmt.Errorf("container %q not found in pod %s, available containers: %s", d.Container, pod.Name, strings.Join(names, ", "))
+	}
+
+	chosen := &containers[0]
+	if c := restartingContainer(pod); d.CrashLoop && c != nil {
+		chosen = c
+	} else if len(containers) > 1 {
+		if c := find(pod.Annotations[defaultContainerAnnotation]); c != nil {
+			chosen = c
+		} else {
+			c, err := askForContainer(pod)
+			if err != nil {
+				return nil, err
+			}
+			chosen = c
+		}
+	}
+
+	d.Container = chosen.Name
+	return chosen, nil
+}
+
+func askForContainer(pod *corev1.Pod) (*corev1.Container, error) {
+	fmt.Printf("Pod '%s' has %d containers. Which one do you want to debug?\n", pod.Name, len(pod.Spec.Containers))
+	for i, c := range pod.Spec.Containers {
+		fmt.Printf("[%d] %s (%s)\n", i+1, c.Name, c.Image)
+	}
+	fmt.Printf("Choose (1-%d) [1]: ", len(pod.Spec.Containers))
+
+	reader := bufio.NewReader(os.Stdin)
+	response, err := reader.ReadString('\n')
+	if err != nil {
+		return nil, fmt.Errorf("error reading selection: %v", err)
+	}
+
+	response = strings.TrimSpace(response)
+	if response == "" {
+		return &pod.Spec.Containers[0], nil
+	}
+	choice, err := strconv.Atoi(response)
+	if err != nil || choice < 1 || choice > len(pod.Spec.Containers) {
+		return nil, fmt.Errorf("invalid selection %q", response)
+	}
+	return &pod.Spec.Containers[choice-1], nil
+}
+
+func (d *Debugger) getTargetContainer(ctx context.Context) (*corev1.Container, error) {
+	pod, err := d.getTargetPod(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error getting container name: %v", err)
+	}
+	return d.chooseTargetContainer(pod)
+}
+
+func (d *Debugger) getTargetContainerName(ctx context.Context) (string, error) {
+	target, err := d.getTargetContainer(ctx)
+	if err != nil {
+		return "", err
+	}
+	return target.Name, nil
+}
+
+// attachArgs returns the kubectl arguments to attach to a debug container
+func (d *Debugger) attachArgs(pod, container string) []string {
+	return []string{"attach", "-it", pod, "-c", container, "-n", d.Namespace}
+}
+
+// attaches reports whether the session is attached to or runs a command,
+// which needs the debug container to be running
+func (d *Debugger) attaches() bool {
+	return d.Interactive && d.TTY || d.isRunMode()
+}
+
+func (d *Debugger) create(ctx context.Context) (*Session, error) {
+	// Choose the target pod by label selector
+	if d.Selector != "" {
+		if err := d.selectTargetPod(ctx); err != nil {
+			return nil, newExecError("error selecting target pod: %v", err)
+		}
+	}
+
+	// Resolve workload references such as deploy/api into a pod name
+	if d.Pod != "" {
+		if err := d.resolveTargetPod(ctx); err != nil {
+			return nil, newExecError("error resolving target: %v", err)
+		}
+	}
+
+	// Node debugging needs the privileged profile and explicit confirmation
+	if d.Node != "" {
+		if err := d.validateNodeDebug(); err != nil {
+			return nil, newExecError("%v", err)
+		}
+	}
+
+	// Check every permission the chosen path needs before changing anything
+	if err := d.rbacPreflight(ctx, d.requiredAccess()); err != nil {
+		return nil, newExecError("%v", err)
+	}
+
+	// Case 1: New standalone debug pod (no target pod specified)
+	if d.Pod == "" {
+		if err := d.podSecurityPreflight(ctx, func() (*corev1.Pod, error) { return d.buildDebugPod(ctx) }); err != nil {
+			return nil, newExecError("%v", err)
+		}
+
+		if d.DryRun {
+			debugPod, err := d.buildDebugPod(ctx)
+			if err != nil {
+				return nil, newExecError("failed to generate debug pod: %v", err)
+			}
+			if err := d.checkNamespaceResources(ctx, debugPod, "debugger"); err != nil {
+				return nil, newExecError("%v", err)
+			}
+			result := &DryRunResult{Pod: debugPod}
+			if d.isRunMode() {
+				result.Command = d.kubectlArgv(d.runCommandArgs(debugPod.Name, "debugger")...)
+			} else if d.Interactive && d.TTY {
+				result.Command = d.kubectlArgv(d.attachArgs(debugPod.Name, "debugger")...)
+			}
+			return &Session{DryRun: result}, nil
+		}
+
+		debugPodName, err := d.createDebugPod(ctx)
+		if err != nil {
+			return nil, newExecError("failed to create debug pod: %v", err)
+		}
+		session := d.newSession(ModeStandalone, debugPodName, "debugger")
+
+		// Wait for pod to be ready only if we're going to attach to it or run a command
+		if d.attaches() {
+			d.logf("Waiting for pod to be ready...")
+			if err := d.waitForPod(ctx, debugPodName); err != nil {
+				return session, newExecError("pod did not become ready: %v", err)
+			}
+		}
+		return session, nil
+	}
+
+	// For cases 2 and 3, verify if target pod exists
+	targetPod, err := d.getTargetPod(ctx)
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil, newExecError("target pod %s does not exist in namespace %s", d.Pod, d.Namespace)
+		}
+		return nil, newExecError("error getting target pod %s: %v", d.Pod, err)
+	}
+
+	// Get the target container
+	target, err := d.getTargetContainer(ctx)
+	if err != nil {
+		return nil, newExecError("error getting container name: %v", err)
+	}
+	containerName := target.Name
+	if d.CrashLoop && !containerRestarting(targetPod, containerName) {
+		return nil, newExecError("container %s of pod %s is not restarting, use --copy to debug it", containerName, d.Pod)
+	}
+
+	// Check for existing debug pod if we're going to create a new one
+	if d.copies() && !d.DryRun {
+		existingPod, err := d.findExistingDebugPod(ctx)
+		if err != nil {
+			return nil, newExecError("error checking for existing debug pods: %v", err)
+		}
+
+		if existingPod != "" && !d.Force && !d.askForNewPod(existingPod) {
+			d.logf("Using existing debug pod: %s\n", existingPod)
+			session := d.newSession(ModeCopy, existingPod, "debugger")
+			session.Reused = true
+			return session, nil
+		}
+	}
+
+	// Check the namespace's Pod Security Standard before changing anything
+	preview := func() (*corev1.Pod, error) {
+		if d.copies() {
+			return d.buildPodCopy(ctx, targetPod, target)
+		}
+		return d.ephemeralPodPreview(ctx, targetPod, target)
+	}
+	if err := d.podSecurityPreflight(ctx, preview); err != nil {
+		return nil, newExecError("%v", err)
+	}
+
+	// Case 2: Create a copy of target pod with debug container
+	if d.copies() {
+		return d.createPodCopy(ctx, targetPod, target)
+	}
+
+	// Case 3: Add debug container to existing pod
+	if d.TTL > 0 {
+		d.logf("Warning: --ttl is ignored for ephemeral containers, it would stop the target pod")
+	}
+
+	ephemeralContainer, err := d.buildEphemeralContainer(ctx, targetPod, target)
+	if err != nil {
+		return nil, newExecError("%v", err)
+	}
+
+	if d.DryRun {
+		result := &DryRunResult{EphemeralContainer: ephemeralContainer}
+		if d.isRunMode() {
+			result.Command = d.kubectlArgv(d.runCommandArgs(d.Pod, ephemeralContainer.Name)...)
+		} else if d.Interactive && d.TTY {
+			result.Command = d.kubectlArgv(d.attachArgs(d.Pod, ephemeralContainer.Name)...)
+		}
+		return &Session{DryRun: result}, nil
+	}
+
+	d.logf("Adding debug container %s to pod %s (targeting container %s)...\n", ephemeralContainer.Name, d.Pod, containerName)
+	if err := d.addEphemeralContainer(ctx, d.Pod, ephemeralContainer); err != nil {
+		return nil, newExecError("%v", err)
+	}
+	session := d.newSession(ModeEphemeral, d.Pod, ephemeralContainer.Name)
+
+	if d.attaches() {
+		d.logf("Waiting for container %s to start...", ephemeralContainer.Name)
+		if err := d.waitForEphemeralContainer(ctx, d.Pod, ephemeralContainer.Name); err != nil {
+			// A container that never started has nothing to stop
+			return nil, newExecError("debug container did not start: %v", err)
+		}
+	}
+	return session, nil
+}
+
+// Export functions for testing
+func (d *Debugger) GetTargetContainerName() (string, error) {
+	return d.getTargetContainerName(context.Background())
+}
+
+func (d *Debugger) GetTargetPodSecurityContext() (*corev1.PodSecurityContext, error) {
+	return d.getTargetPodSecurityContext(context.Background())
+}
+
+func (d *Debugger) WaitForPod(podName string) error {
+	return d.waitForPod(context.Background(), podName)
+}
+
+func (d *Debugger) DeletePod(podName string) error {
+	return d.deletePod(context.Background(), podName)
+}
+
+func (d *Debugger) AttachToPod(podName string) error {
+	return d.attachToPod(context.Background(), podName)
+}
+
+func (d *Debugger) ResolveTargetPod() (string, error) {
+	err := d.resolveTargetPod(context.Background())
+	return d.Pod, err
+}
+
+func (d *Debugger) FindExistingDebugPod() (string, error) {
+	return d.findExistingDebugPod(context.Background())
+}
+
+func (d *Debugger) GenerateUniqueName() string {
+	return d.generateUniqueName()
+}
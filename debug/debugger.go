@@ -0,0 +1,358 @@
+// Package debug creates debug pods, pod copies and ephemeral debug
+// containers with secure defaults. It is what the kubectl-debug command
+// runs, and can be embedded in other tools: all state lives in a Debugger,
+// so concurrent callers with their own Debugger do not affect each other.
+package debug
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"k8s.io/client-go/kubernetes"
+)
+
+// DebugOptions configures a Debugger, every kubectl-debug flag has a field
+type DebugOptions struct {
+	// Namespace of the target and the debug pod, defaults to the namespace
+	// of the kubeconfig context
+	Namespace string
+	// Pod is the target: a pod, a workload as deploy/NAME, sts/NAME, ds/NAME,
+	// job/NAME or svc/NAME, or node/NAME. Empty creates a standalone debug pod.
+	Pod string
+	// Container of the target pod to debug, defaults to the
+	// kubectl.kubernetes.io/default-container annotation
+	Container string
+	// Selector chooses the target pod by labels instead of Pod
+	Selector string
+	// Pick chooses among pods matching Selector without prompting (first,
+	// random, newest, most-restarts)
+	Pick string
+	// Unhealthy picks the least healthy pod of a workload
+	Unhealthy bool
+	// Node is the node of a node/NAME target
+	Node string
+
+	// Image of the debug container
+	Image string
+	// Toolkit selects the image, the default profile and the session
+	// command from the toolkit catalog, overriding Image
+	Toolkit string
+	// Toolkits extends the built-in toolkit catalog by name
+	Toolkits map[string]Toolkit
+	// Profile is a built-in or user-defined security profile
+	Profile string
+	// ProfilesFile and ProfilesConfigMap (NAMESPACE/NAME) hold user-defined profiles
+	ProfilesFile      string
+	ProfilesConfigMap string
+
+	// Interactive and TTY attach the terminal to the debug container
+	Interactive bool
+	TTY         bool
+	// RemoveAfter cleans up the session once it ends
+	RemoveAfter bool
+	// Force creates a new debug pod when one exists and skips confirmations
+	Force bool
+	// Copy debugs a copy of the target pod instead of adding a container
+	Copy bool
+	// CrashLoop debugs a copy of the pod in which the restarting container
+	// is held by an idle process instead of its entrypoint
+	CrashLoop bool
+	// KeepServiceTraffic keeps the target labels Services select on pod
+	// copies, which then receive the Services' traffic
+	KeepServiceTraffic bool
+	// SetImage replaces the image of containers of the pod copy by name,
+	// "*" replaces every image
+	SetImage map[string]string
+	// OverrideCommand replaces the command and arguments of containers of
+	// the pod copy by name
+	OverrideCommand map[string][]string
+	// TTL is the maximum lifetime of debug pods, zero means unlimited
+	TTL time.Duration
+	// WaitTimeout bounds the wait for the debug container to start
+	WaitTimeout time.Duration
+
+	// Resources of the debug container, an empty value leaves it unset
+	CPURequest              string
+	CPULimit                string
+	MemoryRequest           string
+	MemoryLimit             string
+	EphemeralStorageRequest string
+	EphemeralStorageLimit   string
+	// QoS derives CPU and memory requests and limits for a QoS class
+	QoS string
+
+	// Command is run in the debug container instead of an interactive session
+	Command []string
+	// FanOut runs Command in every running pod of the workload or Selector,
+	// Concurrency pods at a time, with FanOutOutput prefix or json
+	FanOut       bool
+	Concurrency  int
+	FanOutOutput string
+
+	// DryRun builds everything without touching the cluster, the result is
+	// returned in Session.DryRun
+	DryRun bool
+
+	// Connection settings, as the kubectl flags of the same name
+	Kubeconfig        string
+	KubeContext       string
+	Cluster           string
+	User              string
+	Impersonate       string
+	ImpersonateGroups []string
+	RequestTimeout    string
+
+	// Clientset is used for API calls instead of one built from the
+	// connection settings, exec and attach sessions still use the connection
+	// settings
+	Clientset kubernetes.Interface
+	// Logger receives progress messages and warnings, the standard logger
+	// by default
+	Logger *log.Logger
+}
+
+// DefaultOptions returns the options kubectl-debug uses without flags
+func DefaultOptions() DebugOptions {
+	return DebugOptions{
+		Image:             "jbuet/debug:latest",
+		ProfilesFile:      defaultProfilesFile(),
+		ProfilesConfigMap: "kube-system/kubectl-debug-profiles",
+		WaitTimeout:       30 * time.Second,
+		CPURequest:        "100m",
+		MemoryRequest:     "128Mi",
+		MemoryLimit:       "128Mi",
+		Concurrency:       5,
+		FanOutOutput:      "prefix",
+		RequestTimeout:    "0",
+	}
+}
+
+// Debugger creates debug sessions with its options. It is not safe for
+// concurrent use, concurrent callers each need their own Debugger.
+type Debugger struct {
+	DebugOptions
+
+	clientset kubernetes.Interface
+	username  *string
+	profiles  map[string]*SecurityProfile
+	toolkit   *Toolkit
+	// sessions creates the executors of exec and attach sessions, which
+	// are streamed through the API server when nil
+	sessions sessionExecutor
+	// quiet drops messages while previews are built
+	quiet bool
+}
+
+// logf logs a progress message or warning unless previews are being built
+func (d *Debugger) logf(format string, args ...interface{}) {
+	if d.quiet {
+		return
+	}
+	if d.Logger != nil {
+		d.Logger.Printf(format, args...)
+		return
+	}
+	log.Printf(format, args...)
+}
+
+// New returns a Debugger with a copy of opts
+func New(opts DebugOptions) *Debugger {
+	opts.Command = append([]string(nil), opts.Command...)
+	opts.ImpersonateGroups = append([]string(nil), opts.ImpersonateGroups...)
+	toolkits := opts.Toolkits
+	opts.Toolkits = map[string]Toolkit{}
+	for name, tk := range toolkits {
+		opts.Toolkits[name] = tk
+	}
+	return &Debugger{DebugOptions: opts}
+}
+
+// Run debugs with opts, see Debugger.Run
+func Run(ctx context.Context, opts DebugOptions) (*Session, error) {
+	return New(opts).Run(ctx)
+}
+
+// Session is a debug pod, pod copy or ephemeral container created by Create
+type Session struct {
+	// Mode is ModeStandalone, ModeCopy or ModeEphemeral
+	Mode      string
+	Namespace string
+	// Pod runs the debug container, it is the target pod in ModeEphemeral
+	Pod       string
+	Container string
+	// Target is the pod being debugged, empty for standalone pods
+	Target string
+	// Reused is set when an existing debug pod was chosen over a new one
+	Reused bool
+	// DryRun is what would have been created with DebugOptions.DryRun, in
+	// which case nothing else is set
+	DryRun *DryRunResult
+
+	debugger *Debugger
+}
+
+func (d *Debugger) newSession(mode, pod, container string) *Session {
+	s := &Session{Mode: mode, Namespace: d.Namespace, Pod: pod, Container: container, debugger: d}
+	if mode != ModeStandalone {
+		s.Target = d.Pod
+	}
+	return s
+}
+
+// Prepare validates the options, resolves the namespace, loads the
+// security profiles unless LoadProfiles was called and applies the
+// toolkit. Run and Create call it.
+func (d *Debugger) Prepare(ctx context.Context) error {
+	if err := d.Validate(); err != nil {
+		return err
+	}
+	if err := d.ResolveNamespace(); err != nil {
+		return err
+	}
+	if d.profiles == nil {
+		if err := d.LoadProfiles(ctx); err != nil {
+			return err
+		}
+	}
+	// Dry runs do not reach the registry of the toolkit's images
+	if err := d.resolveToolkit(ctx, !d.DryRun); err != nil {
+		return err
+	}
+	return d.validateProfileSelection()
+}
+
+// Validate checks the options that do not depend on the cluster, the
+// profile is checked by Prepare once the profiles are loaded
+func (d *Debugger) Validate() error {
+	if d.RemoveAfter && !(d.Interactive && d.TTY) && !d.isRunMode() {
+		return fmt.Errorf("--rm requires -it or a command after --")
+	}
+	if d.Pod != "" && d.Selector != "" {
+		return fmt.Errorf("--pod and --selector cannot be used together")
+	}
+	if (len(d.SetImage) > 0 || len(d.OverrideCommand) > 0) && !d.copies() {
+		return fmt.Errorf("--set-image and --override-command require --copy or --crashloop")
+	}
+	if d.KeepServiceTraffic && !d.copies() {
+		return fmt.Errorf("--keep-service-traffic requires --copy or --crashloop")
+	}
+	if err := d.validateCrashLoop(); err != nil {
+		return err
+	}
+	if err := validatePickStrategy(d.Pick); err != nil {
+		return err
+	}
+	if err := d.validateFanOut(); err != nil {
+		return err
+	}
+	if d.TTL < 0 {
+		return fmt.Errorf("--ttl must not be negative")
+	}
+	if d.WaitTimeout <= 0 {
+		return fmt.Errorf("--timeout must be positive")
+	}
+	_, err := d.debugResources()
+	return err
+}
+
+// Run creates a session, attaches to it or runs Command in it, and cleans
+// it up with RemoveAfter, also when ctx is canceled. With FanOut, Command
+// runs in every pod and no session is returned.
+func (d *Debugger) Run(ctx context.Context) (*Session, error) {
+	if err := d.Prepare(ctx); err != nil {
+		return nil, err
+	}
+	if d.FanOut {
+		return nil, d.runFanOut(ctx)
+	}
+
+	session, err := d.create(ctx)
+	if session == nil || session.DryRun != nil {
+		return session, err
+	}
+	if d.RemoveAfter {
+		defer func() {
+			if ctx.Err() != nil {
+				d.logf("\nInterrupted, cleaning up...")
+			}
+			if err := session.Cleanup(context.Background()); err != nil {
+				d.logf("Warning: %v", err)
+			}
+		}()
+	}
+	if err != nil {
+		return session, err
+	}
+	return session, session.Attach(ctx)
+}
+
+// Create creates the debug pod, pod copy or ephemeral container and waits
+// for it when it will be attached or run Command. When that wait fails,
+// the returned Session still refers to the pod so it can be cleaned up.
+func (d *Debugger) Create(ctx context.Context) (*Session, error) {
+	if err := d.Prepare(ctx); err != nil {
+		return nil, err
+	}
+	if d.FanOut {
+		return nil, fmt.Errorf("fan-out runs are not sessions, use Run")
+	}
+	return d.create(ctx)
+}
+
+// Attach connects the terminal to the debug container, or runs Command in
+// it. Without -it or a command it only tells how to access the container.
+func (s *Session) Attach(ctx context.Context) error {
+	d := s.debugger
+	if s.DryRun != nil {
+		return nil
+	}
+	if d.isRunMode() {
+		return d.runInContainer(ctx, s.Pod, s.Container)
+	}
+
+	if !(d.Interactive && d.TTY) {
+		if s.Mode == ModeEphemeral {
+			d.logf("You can access the container with: kubectl attach -it %s -c %s -n %s\n", s.Pod, s.Container, s.Namespace)
+		} else {
+			d.logf("You can access the pod with: kubectl exec -it %s -n %s -- sh\n", s.Pod, s.Namespace)
+		}
+		return nil
+	}
+
+	// A reused pod's debugger may have exited, a new shell is started there
+	if s.Reused {
+		d.logf("Attaching to pod...\n")
+		return d.attachToPod(ctx, s.Pod)
+	}
+	req := streamRequest{
+		pod:       s.Pod,
+		container: s.Container,
+		stdin:     os.Stdin,
+		stdout:    os.Stdout,
+		stderr:    os.Stderr,
+		tty:       true,
+	}
+	err := d.stream(ctx, req)
+	if _, ok := err.(*CommandExitError); err != nil && !ok {
+		return fmt.Errorf("error attaching to pod: %v", err)
+	}
+	return err
+}
+
+// Cleanup deletes the debug pod or pod copy. Ephemeral containers cannot be
+// removed from a pod, their processes are stopped instead.
+func (s *Session) Cleanup(ctx context.Context) error {
+	d := s.debugger
+	if s.DryRun != nil {
+		return nil
+	}
+	if s.Mode == ModeEphemeral {
+		d.logf("Stopping debug container %s...", s.Container)
+		return d.killEphemeralContainer(ctx, s.Pod, s.Container)
+	}
+	d.logf("Cleaning up debug pod %s...", s.Pod)
+	return d.deletePod(ctx, s.Pod)
+}
@@ -0,0 +1,366 @@
+package debug
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	utilversion "k8s.io/apimachinery/pkg/util/version"
+)
+
+// Doctor check results
+const (
+	StatusPass = "pass"
+	StatusWarn = "warn"
+	StatusFail = "fail"
+)
+
+// DoctorCheck is the result of one environment or cluster check
+type DoctorCheck struct {
+	Name    string `json:"name"`
+	Status  string `json:"status"`
+	Message string `json:"message"`
+}
+
+// doctorReport collects check results and what later checks need from
+// earlier ones
+type doctorReport struct {
+	checks        []DoctorCheck
+	clientVersion *utilversion.Version
+	serverVersion *utilversion.Version
+	nodes         []corev1.Node
+	nodesErr      error
+}
+
+func (r *doctorReport) add(name, status, format string, args ...interface{}) {
+	r.checks = append(r.checks, DoctorCheck{Name: name, Status: status, Message: fmt.Sprintf(format, args...)})
+}
+
+// Doctor checks the local environment and what the cluster allows for
+// debugging, none of the checks stops the others. User-defined profiles
+// are only checked after LoadProfiles.
+func (d *Debugger) Doctor(ctx context.Context) []DoctorCheck {
+	r := &doctorReport{}
+	d.checkKubectl(r)
+	d.checkServerVersion(r)
+	d.checkEphemeralContainers(r)
+
+	if client, err := d.getClient(); err == nil {
+		if nodes, err := client.CoreV1().Nodes().List(ctx, metav1.ListOptions{}); err != nil {
+			r.nodesErr = err
+		} else {
+			r.nodes = nodes.Items
+		}
+	}
+
+	d.checkDebugImage(ctx, r)
+	d.checkNamespacePSA(ctx, r)
+	d.checkCgroups(ctx, r)
+	for _, mode := range debugModes {
+		d.checkModeAccess(ctx, r, mode)
+	}
+	return r.checks
+}
+
+// checkKubectl finds the kubectl binary of the commands kubectl-debug prints.
+// Sessions are streamed through the API server and do not need it.
+func (d *Debugger) checkKubectl(r *doctorReport) {
+	out, err := exec.Command("kubectl", "version", "--client", "-o", "json").Output()
+	if err != nil {
+		r.add("kubectl", StatusWarn, "kubectl is not usable, it is only needed for the commands kubectl-debug prints: %v", err)
+		return
+	}
+
+	var info struct {
+		ClientVersion struct {
+			GitVersion string `json:"gitVersion"`
+		} `json:"clientVersion"`
+	}
+	if err := json.Unmarshal(out, &info); err != nil || info.ClientVersion.GitVersion == "" {
+		r.add("kubectl", StatusWarn, "kubectl found, but its version could not be read")
+		return
+	}
+	r.clientVersion, _ = utilversion.ParseGeneric(info.ClientVersion.GitVersion)
+	r.add("kubectl", StatusPass, "kubectl %s", info.ClientVersion.GitVersion)
+}
+
+// checkServerVersion reads the API server version and compares it with kubectl's
+func (d *Debugger) checkServerVersion(r *doctorReport) {
+	client, err := d.getClient()
+	if err != nil {
+		r.add("server", StatusFail, "%v", err)
+		return
+	}
+	info, err := client.Discovery().ServerVersion()
+	if err != nil {
+		r.add("server", StatusFail, "cannot reach the API server: %v", err)
+		return
+	}
+	r.serverVersion, _ = utilversion.ParseGeneric(info.GitVersion)
+
+	// kubectl supports one minor version of skew in either direction
+	if r.clientVersion != nil && r.serverVersion != nil {
+		skew := int(r.clientVersion.Minor()) - int(r.serverVersion.Minor())
+		if r.clientVersion.Major() != r.serverVersion.Major() || skew > 1 || skew < -1 {
+			r.add("server", StatusWarn, "Kubernetes %s, outside the supported skew of kubectl %s", info.GitVersion, r.clientVersion)
+			return
+		}
+	}
+	r.add("server", StatusPass, "Kubernetes %s", info.GitVersion)
+}
+
+// checkEphemeralContainers looks for the ephemeralcontainers subresource,
+// falling back to the server version when discovery fails
+func (d *Debugger) checkEphemeralContainers(r *doctorReport) {
+	const name = "ephemeral-containers"
+	client, err := d.getClient()
+	if err != nil {
+		r.add(name, StatusFail, "%v", err)
+		return
+	}
+
+	resources, err := client.Discovery().ServerResourcesForGroupVersion("v1")
+	if err == nil {
+		for _, resource := range resources.APIResources {
+			if resource.Name == "pods/ephemeralcontainers" {
+				r.add(name, StatusPass, "pods/ephemeralcontainers is served")
+				return
+			}
+		}
+		r.add(name, StatusFail, "pods/ephemeralcontainers is not served, use --copy")
+		return
+	}
+
+	switch {
+	case r.serverVersion == nil:
+		r.add(name, StatusWarn, "could not be determined: %v", err)
+	case r.serverVersion.AtLeast(utilversion.MajorMinor(1, 25)):
+		r.add(name, StatusPass, "generally available since Kubernetes 1.25")
+	case r.serverVersion.AtLeast(utilversion.MajorMinor(1, 23)):
+		r.add(name, StatusWarn, "beta in Kubernetes %s, enabled unless the feature gate is off", r.serverVersion)
+	default:
+		r.add(name, StatusFail, "not available before Kubernetes 1.23, use --copy")
+	}
+}
+
+// normalizeImage expands an image reference the way container runtimes
+// report it in the node status
+func normalizeImage(ref string) string {
+	name, suffix := ref, ""
+	if i := strings.Index(name, "@"); i >= 0 {
+		name, suffix = name[:i], name[i:]
+	} else if i := strings.LastIndex(name, ":"); i > strings.LastIndex(name, "/") {
+		name, suffix = name[:i], name[i:]
+	} else {
+		suffix = ":latest"
+	}
+
+	parts := strings.SplitN(name, "/", 2)
+	if len(parts) == 1 {
+		name = "docker.io/library/" + name
+	} else if !strings.ContainsAny(parts[0], ".:") && parts[0] != "localhost" {
+		name = "docker.io/" + name
+	}
+	return name + suffix
+}
+
+// checkDebugImage checks that the profile and the namespace's admission
+// policies allow the debug image, the toolkit's when one is selected, and
+// whether nodes already have it
+func (d *Debugger) checkDebugImage(ctx context.Context, r *doctorReport) {
+	const name = "debug-image"
+	// As Prepare does, without reaching the registry of the toolkit's images
+	if err := d.resolveToolkit(ctx, false); err != nil {
+		r.add(name, StatusFail, "%v", err)
+		return
+	}
+	if err := d.validateProfileSelection(); err != nil {
+		r.add(name, StatusFail, "%v", err)
+		return
+	}
+
+	client, err := d.getClient()
+	if err != nil {
+		r.add(name, StatusFail, "%v", err)
+		return
+	}
+
+	// Build the pod with the restricted profile, so only image policies can reject it
+	selected := d.Profile
+	d.Profile = psaRestricted
+	pod, err := d.quietBuild(func() (*corev1.Pod, error) { return d.buildDebugPod(ctx) })
+	d.Profile = selected
+	if err != nil {
+		r.add(name, StatusFail, "%v", err)
+		return
+	}
+
+	_, err = client.CoreV1().Pods(d.Namespace).Create(ctx, pod, metav1.CreateOptions{DryRun: []string{metav1.DryRunAll}})
+	switch {
+	case apierrors.IsForbidden(err) && strings.Contains(err.Error(), "cannot create resource"):
+		r.add(name, StatusWarn, "admission policies for %s not checked, pods cannot be created in namespace %s", d.Image, d.Namespace)
+		return
+	case err != nil:
+		r.add(name, StatusFail, "%v", explainAdmissionError("image "+d.Image, err))
+		return
+	}
+
+	if r.nodesErr != nil {
+		r.add(name, StatusPass, "%s is allowed in namespace %s, node image caches not readable", d.Image, d.Namespace)
+		return
+	}
+	want := normalizeImage(d.Image)
+	cached := 0
+	for _, node := range r.nodes {
+	images:
+		for _, nodeImage := range node.Status.Images {
+			for _, n := range nodeImage.Names {
+				if normalizeImage(n) == want {
+					cached++
+					break images
+				}
+			}
+		}
+	}
+	if cached == 0 {
+		r.add(name, StatusPass, "%s is allowed in namespace %s, not cached on any node and will be pulled", d.Image, d.Namespace)
+		return
+	}
+	r.add(name, StatusPass, "%s is allowed in namespace %s, cached on %d of %d nodes", d.Image, d.Namespace, cached, len(r.nodes))
+}
+
+// checkNamespacePSA reports the enforced Pod Security Standard and which
+// built-in profiles it allows
+func (d *Debugger) checkNamespacePSA(ctx context.Context, r *doctorReport) {
+	const name = "pod-security"
+	level, err := d.namespacePSALevel(ctx)
+	if err != nil {
+		r.add(name, StatusWarn, "cannot read namespace %s: %v", d.Namespace, err)
+		return
+	}
+	if level == psaPrivileged {
+		r.add(name, StatusPass, "no Pod Security Standard enforced in namespace %s", d.Namespace)
+		return
+	}
+
+	selected, current := d.Profile, d.profileName()
+	defer func() { d.Profile = selected }()
+
+	var allowed []string
+	currentAllowed := false
+	for _, candidate := range profileStrength {
+		d.Profile = candidate
+		pod, err := d.quietBuild(func() (*corev1.Pod, error) { return d.buildDebugPod(ctx) })
+		if err != nil || len(checkPodSecurity(pod, level)) > 0 {
+			continue
+		}
+		allowed = append(allowed, candidate)
+		if candidate == current {
+			currentAllowed = true
+		}
+	}
+
+	if currentAllowed {
+		r.add(name, StatusPass, "%s enforced in namespace %s, profile %s is allowed", level, d.Namespace, current)
+		return
+	}
+	r.add(name, StatusWarn, "%s enforced in namespace %s, profile %s is not allowed (allowed: %s)", level, d.Namespace, current, strings.Join(allowed, ", "))
+}
+
+// kernelBefore reports whether a kernel release such as 5.15.0-1051-azure
+// is older than major.minor
+func kernelBefore(release string, major, minor int) bool {
+	parts := strings.SplitN(release, ".", 3)
+	if len(parts) < 2 {
+		return false
+	}
+	kernelMajor, err1 := strconv.Atoi(parts[0])
+	kernelMinor, err2 := strconv.Atoi(strings.TrimRightFunc(parts[1], func(r rune) bool { return r < '0' || r > '9' }))
+	if err1 != nil || err2 != nil {
+		return false
+	}
+	return kernelMajor < major || (kernelMajor == major && kernelMinor < minor)
+}
+
+// checkCgroups finds nodes running cgroup v1. Nodes do not report their
+// cgroup version, so the kubelet's CgroupV1 warning (Kubernetes 1.31+) and
+// kernels older than 5.8, which Kubernetes does not run cgroup v2 on, are used.
+func (d *Debugger) checkCgroups(ctx context.Context, r *doctorReport) {
+	const name = "cgroups"
+	if r.nodesErr != nil {
+		r.add(name, StatusWarn, "cannot list nodes: %v", r.nodesErr)
+		return
+	}
+
+	v1 := map[string]bool{}
+	for _, node := range r.nodes {
+		if kernelBefore(node.Status.NodeInfo.KernelVersion, 5, 8) {
+			v1[node.Name] = true
+		}
+	}
+	if client, err := d.getClient(); err == nil {
+		events, err := client.CoreV1().Events(metav1.NamespaceAll).List(ctx, metav1.ListOptions{
+			FieldSelector: fields.Set{"involvedObject.kind": "Node", "reason": "CgroupV1"}.String(),
+		})
+		if err == nil {
+			for _, event := range events.Items {
+				if event.InvolvedObject.Kind == "Node" && event.Reason == "CgroupV1" {
+					v1[event.InvolvedObject.Name] = true
+				}
+			}
+		}
+	}
+
+	if len(v1) == 0 {
+		r.add(name, StatusPass, "no node of %d reports cgroup v1", len(r.nodes))
+		return
+	}
+	var names []string
+	for _, node := range r.nodes {
+		if v1[node.Name] {
+			names = append(names, node.Name)
+		}
+	}
+	r.add(name, StatusWarn, "%d of %d nodes run cgroup v1, resource usage appears under /sys/fs/cgroup/<controller>: %s", len(names), len(r.nodes), strings.Join(names, ", "))
+}
+
+// checkModeAccess checks the permissions of a debug mode with an attached
+// session. Missing permissions for the mode itself fail, the others warn.
+func (d *Debugger) checkModeAccess(ctx context.Context, r *doctorReport, mode string) {
+	name := "access-" + mode
+	denied, err := d.missingAccess(ctx, d.requiredAccessFor(mode, "attach", true))
+	if err != nil {
+		r.add(name, StatusWarn, "%v", err)
+		return
+	}
+	if len(denied) == 0 {
+		r.add(name, StatusPass, "%s debugging is allowed in namespace %s", mode, d.Namespace)
+		return
+	}
+
+	required := map[accessCheck]bool{}
+	for _, check := range d.requiredAccessFor(mode, "", false) {
+		required[check] = true
+	}
+	status := StatusWarn
+	var missing []string
+	for _, d := range denied {
+		if required[d.accessCheck] {
+			status = StatusFail
+		}
+		missing = append(missing, fmt.Sprintf("%s %s", d.verb, d.resourceName()))
+	}
+	r.add(name, status, "missing in namespace %s: %s", d.Namespace, strings.Join(missing, ", "))
+}
+
+// Export functions for testing
+func NormalizeImage(ref string) string {
+	return normalizeImage(ref)
+}
@@ -0,0 +1,15 @@
+package debug
+
+import (
+	corev1 "k8s.io/api/core/v1"
+)
+
+// DryRunResult is what Create would send to the cluster
+type DryRunResult struct {
+	// Pod is the standalone debug pod or pod copy that would be created
+	Pod *corev1.Pod `json:"pod,omitempty"`
+	// EphemeralContainer is the container patched into the target pod
+	EphemeralContainer *corev1.EphemeralContainer `json:"ephemeralContainer,omitempty"`
+	// Command is the kubectl invocation that would be run
+	Command []string `json:"command,omitempty"`
+}
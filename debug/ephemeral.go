@@ -0,0 +1,226 @@
+package debug
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	utilrand "k8s.io/apimachinery/pkg/util/rand"
+)
+
+// Name prefix of the ephemeral debug containers, as used by kubectl debug
+const ephemeralContainerPrefix = "debugger-"
+
+// debuggerSecurityContext returns the security context of the selected
+// profile for a debugger sharing the target's pod, as an ephemeral container
+// or in a pod copy. The pod-level settings of the profile would change the
+// target's containers, so they are folded into the container context, which
+// then runs as the target container's user.
+func (d *Debugger) debuggerSecurityContext(targetPod *corev1.Pod, target *corev1.Container) *corev1.SecurityContext {
+	containerContext, podContext := d.SecurityContexts(d.Profile)
+
+	if podContext != nil {
+		if containerContext.SeccompProfile == nil {
+			containerContext.SeccompProfile = podContext.SeccompProfile
+		}
+		if containerContext.AppArmorProfile == nil {
+			containerContext.AppArmorProfile = podContext.AppArmorProfile
+		}
+		if containerContext.SELinuxOptions == nil {
+			containerContext.SELinuxOptions = podContext.SELinuxOptions
+		}
+		if containerContext.RunAsUser == nil {
+			containerContext.RunAsUser = podContext.RunAsUser
+		}
+		if containerContext.RunAsGroup == nil {
+			containerContext.RunAsGroup = podContext.RunAsGroup
+		}
+		if containerContext.RunAsNonRoot == nil {
+			containerContext.RunAsNonRoot = podContext.RunAsNonRoot
+		}
+	}
+
+	// The target container's settings win over the pod's
+	var runAsUser, runAsGroup *int64
+	if sc := targetPod.Spec.SecurityContext; sc != nil {
+		runAsUser, runAsGroup = sc.RunAsUser, sc.RunAsGroup
+	}
+	if sc := target.SecurityContext; sc != nil {
+		if sc.RunAsUser != nil {
+			runAsUser = sc.RunAsUser
+		}
+		if sc.RunAsGroup != nil {
+			runAsGroup = sc.RunAsGroup
+		}
+	}
+
+	// Run as the target's user so its processes can be inspected, unless
+	// that is root and the profile does not allow it
+	if runAsUser != nil {
+		if *runAsUser == 0 && containerContext.RunAsNonRoot != nil && *containerContext.RunAsNonRoot {
+			d.logf("Warning: Container %s runs as root, which profile %s does not allow; some of its processes may not be visible", target.Name, d.profileName())
+		} else {
+			containerContext.RunAsUser = runAsUser
+		}
+	}
+	if runAsGroup != nil {
+		containerContext.RunAsGroup = runAsGroup
+	}
+	return containerContext
+}
+
+// buildEphemeralContainer generates the debug container added to the target pod
+func (d *Debugger) buildEphemeralContainer(ctx context.Context, targetPod *corev1.Pod, target *corev1.Container) (*corev1.EphemeralContainer, error) {
+	resources, err := d.debugResources()
+	if err != nil {
+		return nil, err
+	}
+
+	name := ephemeralContainerPrefix + utilrand.String(5)
+	env := append(d.sessionEnv(ctx, targetPod.Name), corev1.EnvVar{Name: envSession, Value: name})
+
+	ec := &corev1.EphemeralContainer{
+		EphemeralContainerCommon: corev1.EphemeralContainerCommon{
+			Name:                     name,
+			Image:                    d.Image,
+			ImagePullPolicy:          corev1.PullIfNotPresent,
+			Env:                      env,
+			Resources:                resources,
+			SecurityContext:          d.debuggerSecurityContext(targetPod, target),
+			Stdin:                    d.Interactive,
+			TTY:                      d.TTY,
+			TerminationMessagePolicy: corev1.TerminationMessageReadFile,
+		},
+		TargetContainerName: target.Name,
+	}
+
+	// A command given after -- is run with kubectl exec, not attached to
+	if d.isRunMode() {
+		ec.Command = keepAliveCommand
+		ec.Stdin = false
+		ec.TTY = false
+	} else {
+		ec.Command = d.sessionCommand()
+	}
+	return ec, nil
+}
+
+// ephemeralContainerPatch returns a strategic merge patch adding ec to the pod
+func ephemeralContainerPatch(ec *corev1.EphemeralContainer) ([]byte, error) {
+	patch := map[string]interface{}{
+		"spec": map[string]interface{}{
+			"ephemeralContainers": []*corev1.EphemeralContainer{ec},
+		},
+	}
+	data, err := json.Marshal(patch)
+	if err != nil {
+		return nil, fmt.Errorf("error marshaling ephemeral container patch: %v", err)
+	}
+	return data, nil
+}
+
+// isResourcesRejected reports whether the API server refused the resources
+// of an ephemeral container, which most Kubernetes versions do not allow
+func isResourcesRejected(err error) bool {
+	statusErr, ok := err.(*apierrors.StatusError)
+	if !ok || !apierrors.IsInvalid(err) || statusErr.ErrStatus.Details == nil {
+		return false
+	}
+	for _, cause := range statusErr.ErrStatus.Details.Causes {
+		if strings.HasSuffix(cause.Field, ".resources") {
+			return true
+		}
+	}
+	return false
+}
+
+// addEphemeralContainer patches the ephemeralcontainers subresource of the
+// target pod. kubectl debug cannot set resources, so the tool does it itself.
+func (d *Debugger) addEphemeralContainer(ctx context.Context, podName string, ec *corev1.EphemeralContainer) error {
+	client, err := d.getClient()
+	if err != nil {
+		return err
+	}
+
+	patch, err := ephemeralContainerPatch(ec)
+	if err != nil {
+		return err
+	}
+	_, err = client.CoreV1().Pods(d.Namespace).Patch(ctx, podName, types.StrategicMergePatchType, patch, metav1.PatchOptions{}, "ephemeralcontainers")
+	if err != nil && isResourcesRejected(err) && !isEmptyResources(ec.Resources) {
+		d.logf("Warning: The cluster does not allow resources on ephemeral containers, adding %s without them", ec.Name)
+		ec.Resources = corev1.ResourceRequirements{}
+		if patch, err = ephemeralContainerPatch(ec); err != nil {
+			return err
+		}
+		_, err = client.CoreV1().Pods(d.Namespace).Patch(ctx, podName, types.StrategicMergePatchType, patch, metav1.PatchOptions{}, "ephemeralcontainers")
+	}
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return fmt.Errorf("ephemeral containers are not supported by this cluster: %v", err)
+		}
+		return fmt.Errorf("error adding ephemeral container to pod %s: %v", podName, explainAdmissionError("debug container", err))
+	}
+	return nil
+}
+
+func isEmptyResources(resources corev1.ResourceRequirements) bool {
+	return len(resources.Limits) == 0 && len(resources.Requests) == 0
+}
+
+// killScript stops every process started in the ephemeral container, found by
+// its envSession variable. The processes get SIGHUP first, which interactive
+// shells do not ignore, and SIGKILL if they are still around.
+const killScript = `for sig in HUP KILL; do
+  for environ in /proc/[0-9]*/environ; do
+    pid=${environ#/proc/}; pid=${pid%%/environ}
+    [ "$pid" = "$$" ] && continue
+    { tr '\0' '\n' < "$environ"; } 2>/dev/null | grep -qx "$1=$2" && kill -$sig "$pid" 2>/dev/null
+  done
+  sleep 1
+done
+true`
+
+// killEphemeralContainer stops the debugger process so the ephemeral
+// container terminates. Ephemeral containers cannot be removed from a pod.
+func (d *Debugger) killEphemeralContainer(ctx context.Context, podName, name string) error {
+	client, err := d.getClient()
+	if err != nil {
+		return err
+	}
+
+	// Nothing to do when the session ended with the shell
+	pod, err := client.CoreV1().Pods(d.Namespace).Get(ctx, podName, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("error getting pod %s: %v", podName, err)
+	}
+	for _, status := range pod.Status.EphemeralContainerStatuses {
+		if status.Name == name && status.State.Terminated != nil {
+			return nil
+		}
+	}
+
+	var output bytes.Buffer
+	req := streamRequest{
+		pod:       podName,
+		container: name,
+		command:   []string{"sh", "-c", killScript, "sh", envSession, name},
+		stdout:    &output,
+		stderr:    &output,
+	}
+	if err := d.stream(ctx, req); err != nil {
+		// The exec session is killed with the container, so only a
+		// session that did not run at all is an error
+		if _, ok := err.(*CommandExitError); !ok {
+			return fmt.Errorf("error stopping container %s: %v: %s", name, err, strings.TrimSpace(output.String()))
+		}
+	}
+	d.logf("Debug container %s stopped", name)
+	return nil
+}
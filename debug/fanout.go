@@ -0,0 +1,325 @@
+package debug
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sync"
+	"text/tabwriter"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// FanOutResult is the outcome of the command in one pod of an --all run
+type FanOutResult struct {
+	Pod       string `json:"pod"`
+	Container string `json:"container,omitempty"`
+	// ExitCode is missing when the command could not be run
+	ExitCode *int   `json:"exitCode,omitempty"`
+	Stdout   string `json:"stdout"`
+	Stderr   string `json:"stderr"`
+	Error    string `json:"error,omitempty"`
+}
+
+// fanOutTarget is a pod the command runs in and its debug container
+type fanOutTarget struct {
+	pod       *corev1.Pod
+	container *corev1.EphemeralContainer
+	result    *FanOutResult
+}
+
+func (d *Debugger) validateFanOut() error {
+	if !d.FanOut {
+		return nil
+	}
+	if !d.isRunMode() {
+		return fmt.Errorf("--all requires a command after --")
+	}
+	if d.Selector == "" {
+		if d.Pod == "" {
+			return fmt.Errorf("--all requires a workload in --pod or a --selector")
+		}
+		kind, _, err := parseTargetRef(d.Pod)
+		if err != nil {
+			return err
+		}
+		if kind == "Pod" || kind == "Node" {
+			return fmt.Errorf("--all requires a workload such as deploy/NAME in --pod, or a --selector")
+		}
+	}
+	switch {
+	case d.Copy:
+		return fmt.Errorf("--all uses ephemeral containers and cannot be combined with --copy")
+	case d.CrashLoop:
+		return fmt.Errorf("--all uses ephemeral containers and cannot be combined with --crashloop")
+	case d.Interactive || d.TTY:
+		return fmt.Errorf("--all cannot be combined with -i or -t")
+	case d.DryRun:
+		return fmt.Errorf("--all cannot be combined with --dry-run")
+	case d.Concurrency < 1:
+		return fmt.Errorf("--concurrency must be at least 1")
+	}
+	switch d.FanOutOutput {
+	case "prefix", "json":
+	default:
+		return fmt.Errorf("invalid --all-output %q: must be one of: prefix, json", d.FanOutOutput)
+	}
+	return nil
+}
+
+// fanOutPods returns the running pods of the workload in --pod or matching --selector
+func (d *Debugger) fanOutPods(ctx context.Context) ([]corev1.Pod, error) {
+	var pods []corev1.Pod
+	if d.Selector != "" {
+		matched, err := d.selectorPods(ctx)
+		if err != nil {
+			return nil, err
+		}
+		pods = matched
+	} else {
+		kind, name, err := parseTargetRef(d.Pod)
+		if err != nil {
+			return nil, err
+		}
+		if pods, err = d.getWorkloadPods(ctx, kind, name); err != nil {
+			return nil, err
+		}
+		if len(pods) == 0 {
+			return nil, fmt.Errorf("no pods found for %s in namespace %s", d.Pod, d.Namespace)
+		}
+	}
+
+	// Ephemeral containers only start in running pods
+	var running []corev1.Pod
+	for _, pod := range pods {
+		if pod.Status.Phase == corev1.PodRunning && pod.DeletionTimestamp == nil {
+			running = append(running, pod)
+		} else {
+			d.logf("Warning: Skipping pod %s, it is %s", pod.Name, pod.Status.Phase)
+		}
+	}
+	if len(running) == 0 {
+		return nil, fmt.Errorf("none of the %d pods is running", len(pods))
+	}
+	return running, nil
+}
+
+// prefixWriter writes each complete line prefixed with the pod name, so the
+// output of pods running in parallel does not mix within a line
+type prefixWriter struct {
+	mu     *sync.Mutex
+	out    io.Writer
+	prefix string
+	buf    []byte
+}
+
+func (w *prefixWriter) Write(p []byte) (int, error) {
+	w.buf = append(w.buf, p...)
+	for {
+		i := bytes.IndexByte(w.buf, '\n')
+		if i < 0 {
+			return len(p), nil
+		}
+		w.writeLine(w.buf[:i+1])
+		w.buf = w.buf[i+1:]
+	}
+}
+
+// Flush writes a last line without newline
+func (w *prefixWriter) Flush() {
+	if len(w.buf) > 0 {
+		w.writeLine(append(w.buf, '\n'))
+		w.buf = nil
+	}
+}
+
+func (w *prefixWriter) writeLine(line []byte) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	fmt.Fprintf(w.out, "%s | %s", w.prefix, line)
+}
+
+// runFanOutTarget debugs one pod: adds its ephemeral container, runs the
+// command and stops the container with --rm
+func (d *Debugger) runFanOutTarget(ctx context.Context, t *fanOutTarget, outputMu *sync.Mutex) {
+	name := t.pod.Name
+	if err := d.addEphemeralContainer(ctx, name, t.container); err != nil {
+		t.result.Error = err.Error()
+		return
+	}
+	if err := d.waitForEphemeralContainer(ctx, name, t.container.Name); err != nil {
+		t.result.Error = fmt.Sprintf("debug container did not start: %v", err)
+		return
+	}
+	if d.RemoveAfter {
+		defer func() {
+			if err := d.killEphemeralContainer(context.Background(), name, t.container.Name); err != nil {
+				d.logf("Warning: %v", err)
+			}
+		}()
+	}
+
+	var stdout, stderr bytes.Buffer
+	var stdoutWriter, stderrWriter io.Writer = &stdout, &stderr
+	if d.FanOutOutput == "prefix" {
+		prefixedOut := &prefixWriter{mu: outputMu, out: os.Stdout, prefix: name}
+		prefixedErr := &prefixWriter{mu: outputMu, out: os.Stderr, prefix: name}
+		defer prefixedOut.Flush()
+		defer prefixedErr.Flush()
+		stdoutWriter, stderrWriter = prefixedOut, prefixedErr
+	}
+
+	err := d.execInContainer(ctx, name, t.container.Name, nil, stdoutWriter, stderrWriter)
+	t.result.Stdout, t.result.Stderr = stdout.String(), stderr.String()
+	code := 0
+	if exitErr, ok := err.(*CommandExitError); ok {
+		code = exitErr.Code
+	} else if err != nil {
+		t.result.Error = err.Error()
+		return
+	}
+	t.result.ExitCode = &code
+}
+
+// runFanOut runs the command in an ephemeral container of every pod of the
+// workload or selector, at most --concurrency pods at a time
+func (d *Debugger) runFanOut(ctx context.Context) error {
+	pods, err := d.fanOutPods(ctx)
+	if err != nil {
+		return newExecError("error selecting target pods: %v", err)
+	}
+	if err := d.rbacPreflight(ctx, d.requiredAccessFor(ModeEphemeral, "exec", d.RemoveAfter)); err != nil {
+		return newExecError("%v", err)
+	}
+
+	// Replicas share their containers, the first pod decides which is targeted
+	first := &pods[0]
+	target, err := d.chooseTargetContainer(first)
+	if err != nil {
+		return newExecError("error getting container name: %v", err)
+	}
+	if err := d.podSecurityPreflight(ctx, func() (*corev1.Pod, error) { return d.ephemeralPodPreview(ctx, first, target) }); err != nil {
+		return newExecError("%v", err)
+	}
+
+	// Containers are built one by one, only the API calls run in parallel
+	targets := make([]*fanOutTarget, len(pods))
+	for i := range pods {
+		t := &fanOutTarget{pod: &pods[i], result: &FanOutResult{Pod: pods[i].Name}}
+		targets[i] = t
+		target, err := d.chooseTargetContainer(t.pod)
+		if err != nil {
+			t.result.Error = err.Error()
+			continue
+		}
+		if t.container, err = d.buildEphemeralContainer(ctx, t.pod, target); err != nil {
+			t.result.Error = err.Error()
+			continue
+		}
+		t.result.Container = t.container.Name
+	}
+
+	d.logf("Running %v in %d pods, %d at a time...", d.Command, len(targets), d.Concurrency)
+	var outputMu sync.Mutex
+	var wg sync.WaitGroup
+	slots := make(chan struct{}, d.Concurrency)
+	for _, t := range targets {
+		if t.container == nil {
+			continue
+		}
+		wg.Add(1)
+		go func(t *fanOutTarget) {
+			defer wg.Done()
+			slots <- struct{}{}
+			defer func() { <-slots }()
+
+			d.runFanOutTarget(ctx, t, &outputMu)
+			if d.FanOutOutput == "json" {
+				outputMu.Lock()
+				defer outputMu.Unlock()
+				printFanOutResult(t.result)
+			}
+		}(t)
+	}
+	wg.Wait()
+
+	// Pods that failed before running the command are reported in JSON too
+	if d.FanOutOutput == "json" {
+		for _, t := range targets {
+			if t.container == nil {
+				printFanOutResult(t.result)
+			}
+		}
+	}
+
+	results := make([]*FanOutResult, len(targets))
+	for i, t := range targets {
+		results[i] = t.result
+	}
+	printFanOutSummary(results)
+	return fanOutExitError(results)
+}
+
+// printFanOutResult writes one result as a single line JSON document
+func printFanOutResult(result *FanOutResult) {
+	data, err := json.Marshal(result)
+	if err != nil {
+		log.Printf("Warning: Could not marshal result of pod %s: %v", result.Pod, err)
+		return
+	}
+	fmt.Println(string(data))
+}
+
+// printFanOutSummary writes the exit code of every pod to stderr, stdout
+// only carries the command output
+func printFanOutSummary(results []*FanOutResult) {
+	succeeded := 0
+	w := tabwriter.NewWriter(os.Stderr, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(w, "POD\tCONTAINER\tRESULT")
+	for _, r := range results {
+		var outcome string
+		switch {
+		case r.Error != "":
+			outcome = "error: " + r.Error
+		case *r.ExitCode == 0:
+			outcome = "exit 0"
+			succeeded++
+		default:
+			outcome = fmt.Sprintf("exit %d", *r.ExitCode)
+		}
+		container := r.Container
+		if container == "" {
+			container = "<none>"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\n", r.Pod, container, outcome)
+	}
+	w.Flush()
+	fmt.Fprintf(os.Stderr, "Command succeeded in %d of %d pods\n", succeeded, len(results))
+}
+
+// fanOutExitError returns the highest exit code of the command, or 1 when
+// it could not run somewhere
+func fanOutExitError(results []*FanOutResult) error {
+	code := 0
+	for _, r := range results {
+		switch {
+		case r.Error != "" && code < 1:
+			code = 1
+		case r.ExitCode != nil && *r.ExitCode > code:
+			code = *r.ExitCode
+		}
+	}
+	if code == 0 {
+		return nil
+	}
+	return &CommandExitError{Code: code}
+}
+
+// Export functions for testing
+func (d *Debugger) ValidateFanOut() error {
+	return d.validateFanOut()
+}
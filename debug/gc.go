@@ -0,0 +1,116 @@
+package debug
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Annotations recording the TTL of a debug pod
+const (
+	ttlAnnotation       = "debug-tool/ttl"
+	expiresAtAnnotation = "debug-tool/expires-at"
+)
+
+// ttlAnnotations returns the annotations that record the TTL of a pod created now
+func (d *Debugger) ttlAnnotations() map[string]string {
+	return map[string]string{
+		ttlAnnotation:       d.TTL.String(),
+		expiresAtAnnotation: time.Now().Add(d.TTL).UTC().Format(time.RFC3339),
+	}
+}
+
+// podExpiry returns when the TTL of a pod runs out
+func podExpiry(pod *corev1.Pod) *time.Time {
+	value, ok := pod.Annotations[expiresAtAnnotation]
+	if !ok {
+		return nil
+	}
+	expires, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return nil
+	}
+	return &expires
+}
+
+// GCFilter selects the debug pods gc deletes, empty fields match every pod
+type GCFilter struct {
+	AllNamespaces bool
+	OlderThan     time.Duration
+	Target        string
+	Creator       string
+	// Expired matches pods whose TTL passed or that already finished
+	Expired bool
+}
+
+// GCCandidates returns the debug pods and pod copies matching filter.
+// Only pods carrying the labels of the tool are returned, so workloads that
+// happen to set the debug environment variables are never deleted.
+// Ephemeral containers are never returned, removing them means deleting
+// the pod they debug.
+func (d *Debugger) GCCandidates(ctx context.Context, filter GCFilter) ([]DebugSession, error) {
+	sessions, err := d.listSessions(ctx, filter.AllNamespaces, "debug-tool/type=debug-pod")
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	seen := map[string]bool{}
+	var candidates []DebugSession
+	for _, s := range sessions {
+		// Deleting an ephemeral container means deleting the target pod
+		if s.Type == "ephemeral" {
+			continue
+		}
+		key := s.Namespace + "/" + s.Pod
+		if seen[key] {
+			continue
+		}
+		if filter.OlderThan > 0 && now.Sub(s.Created) < filter.OlderThan {
+			continue
+		}
+		if filter.Target != "" && s.Target != filter.Target {
+			continue
+		}
+		if filter.Creator != "" && s.Creator != filter.Creator {
+			continue
+		}
+		if filter.Expired {
+			finished := s.Phase == string(corev1.PodFailed) || s.Phase == string(corev1.PodSucceeded)
+			expired := s.Expires != nil && now.After(*s.Expires)
+			if !finished && !expired {
+				continue
+			}
+		}
+		seen[key] = true
+		candidates = append(candidates, s)
+	}
+	return candidates, nil
+}
+
+// DeletePods deletes the pods of sessions returned by GCCandidates
+func (d *Debugger) DeletePods(ctx context.Context, sessions []DebugSession) error {
+	client, err := d.getClient()
+	if err != nil {
+		return err
+	}
+
+	var failed []string
+	for _, s := range sessions {
+		if err := client.CoreV1().Pods(s.Namespace).Delete(ctx, s.Pod, metav1.DeleteOptions{}); err != nil && !apierrors.IsNotFound(err) {
+			d.logf("Warning: Failed to delete pod %s/%s: %v", s.Namespace, s.Pod, err)
+			failed = append(failed, s.Namespace+"/"+s.Pod)
+			continue
+		}
+		d.logf("Pod %s/%s deleted", s.Namespace, s.Pod)
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("failed to delete %d debug pod(s): %s", len(failed), strings.Join(failed, ", "))
+	}
+	return nil
+}
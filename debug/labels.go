@@ -0,0 +1,227 @@
+package debug
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// labelSelection is a label selector that picks the target pod: one of
+// its controllers or a Service
+type labelSelection struct {
+	// Kind and Name of the selecting object, such as ReplicaSet api-5d9f
+	Kind     string
+	Name     string
+	Selector *metav1.LabelSelector
+}
+
+func (s labelSelection) String() string {
+	return s.Kind + " " + s.Name
+}
+
+// keys returns the label keys whose removal stops the selector from
+// matching: those of matchLabels and of In and Exists expressions
+func (s labelSelection) keys() []string {
+	var keys []string
+	for key := range s.Selector.MatchLabels {
+		keys = append(keys, key)
+	}
+	for _, expr := range s.Selector.MatchExpressions {
+		if expr.Operator == metav1.LabelSelectorOpIn || expr.Operator == metav1.LabelSelectorOpExists {
+			keys = append(keys, expr.Key)
+		}
+	}
+	return keys
+}
+
+// adopts reports whether the selecting controller adopts orphaned pods its
+// selector matches
+func (s labelSelection) adopts() bool {
+	switch s.Kind {
+	case "ReplicaSet", "ReplicationController", "StatefulSet", "DaemonSet", "Job":
+		return true
+	}
+	return false
+}
+
+func (s labelSelection) matches(podLabels map[string]string) bool {
+	selector, err := metav1.LabelSelectorAsSelector(s.Selector)
+	if err != nil || selector.Empty() {
+		return false
+	}
+	return selector.Matches(labels.Set(podLabels))
+}
+
+// ownerSelections returns the selectors of the controllers owning the
+// objects in refs and of their own owners, such as the ReplicaSet of a pod
+// and its Deployment
+func (d *Debugger) ownerSelections(ctx context.Context, refs []metav1.OwnerReference) ([]labelSelection, error) {
+	client, err := d.getClient()
+	if err != nil {
+		return nil, err
+	}
+
+	var selections []labelSelection
+	for _, ref := range refs {
+		var selector *metav1.LabelSelector
+		var owners []metav1.OwnerReference
+
+		switch ref.Kind {
+		case "ReplicaSet":
+			rs, err := client.AppsV1().ReplicaSets(d.Namespace).Get(ctx, ref.Name, metav1.GetOptions{})
+			if err != nil {
+				return nil, fmt.Errorf("error getting replicaset %s: %v", ref.Name, err)
+			}
+			selector, owners = rs.Spec.Selector, rs.OwnerReferences
+		case "ReplicationController":
+			rc, err := client.CoreV1().ReplicationControllers(d.Namespace).Get(ctx, ref.Name, metav1.GetOptions{})
+			if err != nil {
+				return nil, fmt.Errorf("error getting replicationcontroller %s: %v", ref.Name, err)
+			}
+			selector = &metav1.LabelSelector{MatchLabels: rc.Spec.Selector}
+		case "Deployment":
+			deployment, err := client.AppsV1().Deployments(d.Namespace).Get(ctx, ref.Name, metav1.GetOptions{})
+			if err != nil {
+				return nil, fmt.Errorf("error getting deployment %s: %v", ref.Name, err)
+			}
+			selector = deployment.Spec.Selector
+		case "StatefulSet":
+			statefulSet, err := client.AppsV1().StatefulSets(d.Namespace).Get(ctx, ref.Name, metav1.GetOptions{})
+			if err != nil {
+				return nil, fmt.Errorf("error getting statefulset %s: %v", ref.Name, err)
+			}
+			selector = statefulSet.Spec.Selector
+		case "DaemonSet":
+			daemonSet, err := client.AppsV1().DaemonSets(d.Namespace).Get(ctx, ref.Name, metav1.GetOptions{})
+			if err != nil {
+				return nil, fmt.Errorf("error getting daemonset %s: %v", ref.Name, err)
+			}
+			selector = daemonSet.Spec.Selector
+		case "Job":
+			job, err := client.BatchV1().Jobs(d.Namespace).Get(ctx, ref.Name, metav1.GetOptions{})
+			if err != nil {
+				return nil, fmt.Errorf("error getting job %s: %v", ref.Name, err)
+			}
+			selector, owners = job.Spec.Selector, job.OwnerReferences
+		case "CronJob":
+			// CronJobs own their Jobs, a selector is only set in the job template
+			cronJob, err := client.BatchV1().CronJobs(d.Namespace).Get(ctx, ref.Name, metav1.GetOptions{})
+			if err != nil {
+				return nil, fmt.Errorf("error getting cronjob %s: %v", ref.Name, err)
+			}
+			selector = cronJob.Spec.JobTemplate.Spec.Selector
+		default:
+			d.logf("Warning: Labels selected by %s %s are not known and are kept", ref.Kind, ref.Name)
+			continue
+		}
+
+		if selector != nil {
+			selections = append(selections, labelSelection{Kind: ref.Kind, Name: ref.Name, Selector: selector})
+		}
+		ownerSelections, err := d.ownerSelections(ctx, owners)
+		if err != nil {
+			return nil, err
+		}
+		selections = append(selections, ownerSelections...)
+	}
+	return selections, nil
+}
+
+// serviceSelections returns the selectors of the Services sending traffic
+// to a pod with the given labels
+func (d *Debugger) serviceSelections(ctx context.Context, podLabels map[string]string) ([]labelSelection, error) {
+	client, err := d.getClient()
+	if err != nil {
+		return nil, err
+	}
+	services, err := client.CoreV1().Services(d.Namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("error listing services: %v", err)
+	}
+
+	var selections []labelSelection
+	for _, service := range services.Items {
+		if len(service.Spec.Selector) == 0 {
+			continue
+		}
+		selection := labelSelection{
+			Kind:     "Service",
+			Name:     service.Name,
+			Selector: &metav1.LabelSelector{MatchLabels: service.Spec.Selector},
+		}
+		if selection.matches(podLabels) {
+			selections = append(selections, selection)
+		}
+	}
+	return selections, nil
+}
+
+// targetLabels returns the labels of the target pod a debug pod or pod
+// copy can keep: those no controller of the target selects, so it is not
+// adopted, and, unless KeepServiceTraffic, those no Service selects, so it
+// gets no traffic
+func (d *Debugger) targetLabels(ctx context.Context, targetPod *corev1.Pod) (map[string]string, error) {
+	owners, err := d.ownerSelections(ctx, targetPod.OwnerReferences)
+	if err != nil {
+		return nil, err
+	}
+	services, err := d.serviceSelections(ctx, targetPod.Labels)
+	if err != nil {
+		return nil, err
+	}
+
+	// Service selectors are kept to keep the traffic, controllers are then
+	// stopped by removing the rest of their selector
+	kept := map[string]bool{}
+	strip := append([]labelSelection(nil), owners...)
+	if d.KeepServiceTraffic {
+		for _, service := range services {
+			for _, key := range service.keys() {
+				kept[key] = true
+			}
+		}
+	} else {
+		strip = append(strip, services...)
+	}
+
+	result := make(map[string]string, len(targetPod.Labels))
+	for key, value := range targetPod.Labels {
+		result[key] = value
+	}
+	removed := map[string][]string{}
+	for _, selection := range strip {
+		for _, key := range selection.keys() {
+			if _, ok := targetPod.Labels[key]; ok && !kept[key] {
+				delete(result, key)
+				removed[key] = append(removed[key], selection.String())
+			}
+		}
+	}
+
+	if len(removed) > 0 {
+		keys := make([]string, 0, len(removed))
+		for key := range removed {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		d.logf("Removing labels selected by controllers or Services of %s:", targetPod.Name)
+		for _, key := range keys {
+			d.logf("  %s (%s)", key, strings.Join(removed[key], ", "))
+		}
+	}
+	keptLabels := "the kept labels"
+	if d.KeepServiceTraffic {
+		keptLabels = "the labels kept for --keep-service-traffic"
+	}
+	for _, owner := range owners {
+		if owner.adopts() && owner.matches(result) {
+			d.logf("Warning: %s still selects %s and may adopt the debug pod", owner, keptLabels)
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,185 @@
+package debug
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// modeLabel marks pod copies among the labeled debug pods
+const modeLabel = "debug-tool/mode"
+
+// Environment variables set on every debugger container the tool creates.
+// They identify ephemeral containers, which carry no labels, and pod copies
+// made by kubectl debug before copies were labeled. Those copies are listed
+// but never garbage collected, nothing proves the tool created them.
+const (
+	envTarget  = "DEBUG_TOOL_TARGET"
+	envProfile = "DEBUG_TOOL_PROFILE"
+	envCreator = "DEBUG_TOOL_CREATOR"
+	// envSession holds the ephemeral container name, to find its processes
+	// in the process namespace it shares with the target
+	envSession = "DEBUG_TOOL_SESSION"
+)
+
+// DebugSession describes a debug pod or ephemeral debugger container
+type DebugSession struct {
+	Namespace string     `json:"namespace"`
+	Pod       string     `json:"pod"`
+	Container string     `json:"container"`
+	Type      string     `json:"type"`
+	Target    string     `json:"target,omitempty"`
+	Profile   string     `json:"profile,omitempty"`
+	Image     string     `json:"image"`
+	Creator   string     `json:"creator,omitempty"`
+	Created   time.Time  `json:"created"`
+	Expires   *time.Time `json:"expires,omitempty"`
+	Node      string     `json:"node,omitempty"`
+	Phase     string     `json:"phase"`
+}
+
+// profileName returns the profile recorded for a session
+func (d *Debugger) profileName() string {
+	if d.Profile == "" {
+		return "general"
+	}
+	return d.Profile
+}
+
+// sessionEnv returns the environment that marks a debugger container
+func (d *Debugger) sessionEnv(ctx context.Context, target string) []corev1.EnvVar {
+	env := []corev1.EnvVar{
+		{Name: envTarget, Value: target},
+		{Name: envProfile, Value: d.profileName()},
+	}
+	if creator := d.currentUser(ctx); creator != "" {
+		env = append(env, corev1.EnvVar{Name: envCreator, Value: creator})
+	}
+	return env
+}
+
+func envValue(env []corev1.EnvVar, name string) (string, bool) {
+	for _, e := range env {
+		if e.Name == name {
+			return e.Value, true
+		}
+	}
+	return "", false
+}
+
+// ListSessions returns the debug sessions in the namespace, or in every
+// namespace with allNamespaces
+func (d *Debugger) ListSessions(ctx context.Context, allNamespaces bool) ([]DebugSession, error) {
+	// Ephemeral containers are not labeled, so every pod is inspected
+	return d.listSessions(ctx, allNamespaces, "")
+}
+
+// listSessions returns the debug sessions hosted by the pods matching
+// labelSelector
+func (d *Debugger) listSessions(ctx context.Context, allNamespaces bool, labelSelector string) ([]DebugSession, error) {
+	client, err := d.getClient()
+	if err != nil {
+		return nil, err
+	}
+
+	ns := d.Namespace
+	if allNamespaces {
+		ns = metav1.NamespaceAll
+	}
+
+	pods, err := client.CoreV1().Pods(ns).List(ctx, metav1.ListOptions{LabelSelector: labelSelector})
+	if err != nil {
+		return nil, fmt.Errorf("error listing pods: %v", err)
+	}
+
+	var sessions []DebugSession
+	for i := range pods.Items {
+		sessions = append(sessions, podDebugSessions(&pods.Items[i])...)
+	}
+
+	sort.SliceStable(sessions, func(i, j int) bool {
+		if sessions[i].Namespace != sessions[j].Namespace {
+			return sessions[i].Namespace < sessions[j].Namespace
+		}
+		return sessions[i].Created.Before(sessions[j].Created)
+	})
+	return sessions, nil
+}
+
+// podDebugSessions returns the debug sessions hosted by a pod
+func podDebugSessions(pod *corev1.Pod) []DebugSession {
+	var sessions []DebugSession
+
+	newSession := func(container, containerImage string, env []corev1.EnvVar) DebugSession {
+		target, _ := envValue(env, envTarget)
+		sessionProfile, _ := envValue(env, envProfile)
+		creator, _ := envValue(env, envCreator)
+		return DebugSession{
+			Namespace: pod.Namespace,
+			Pod:       pod.Name,
+			Container: container,
+			Target:    target,
+			Profile:   sessionProfile,
+			Image:     containerImage,
+			Creator:   creator,
+			Created:   pod.CreationTimestamp.Time,
+			Expires:   podExpiry(pod),
+			Node:      pod.Spec.NodeName,
+			Phase:     string(pod.Status.Phase),
+		}
+	}
+
+	isDebugPod := pod.Labels["debug-tool/type"] == "debug-pod"
+	for _, c := range pod.Spec.Containers {
+		_, marked := envValue(c.Env, envTarget)
+		if !marked && !(isDebugPod && c.Name == "debugger") {
+			continue
+		}
+
+		session := newSession(c.Name, c.Image, c.Env)
+		switch {
+		case pod.Labels["debug-tool/node"] != "" || (isDebugPod && pod.Spec.HostPID && pod.Spec.NodeName != ""):
+			session.Type = "node"
+		case pod.Labels[modeLabel] == ModeCopy:
+			session.Type = "copy"
+		case isDebugPod:
+			session.Type = "pod"
+		default:
+			session.Type = "copy"
+		}
+		if session.Target == "" {
+			session.Target = pod.Labels["debug-tool/target"]
+		}
+		sessions = append(sessions, session)
+	}
+
+	for _, c := range pod.Spec.EphemeralContainers {
+		if _, marked := envValue(c.Env, envTarget); !marked {
+			continue
+		}
+
+		session := newSession(c.Name, c.Image, c.Env)
+		session.Type = "ephemeral"
+		session.Phase = "Waiting"
+		for _, status := range pod.Status.EphemeralContainerStatuses {
+			if status.Name != c.Name {
+				continue
+			}
+			switch {
+			case status.State.Running != nil:
+				session.Phase = "Running"
+				session.Created = status.State.Running.StartedAt.Time
+			case status.State.Terminated != nil:
+				session.Phase = "Terminated"
+				session.Created = status.State.Terminated.StartedAt.Time
+			}
+		}
+		sessions = append(sessions, session)
+	}
+
+	return sessions
+}
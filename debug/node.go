@@ -0,0 +1,81 @@
+package debug
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/utils/pointer"
+)
+
+// Path where the node's root filesystem is mounted in the debug container
+const hostRootMountPath = "/host"
+
+// validateNodeDebug checks that node debugging runs under the privileged
+// profile and that the user confirmed it, unless --force is given or it is a
+// dry run, which creates nothing.
+func (d *Debugger) validateNodeDebug() error {
+	if d.Profile != "privileged" {
+		return fmt.Errorf("debugging node %s requires --profile privileged", d.Node)
+	}
+	if d.Force || d.DryRun {
+		return nil
+	}
+	if !d.askForNodeDebug() {
+		return fmt.Errorf("node debugging cancelled")
+	}
+	return nil
+}
+
+func (d *Debugger) askForNodeDebug() bool {
+	fmt.Printf("This will create a privileged pod on node '%s' with access to the host PID, network and IPC namespaces and its root filesystem at %s.\n", d.Node, hostRootMountPath)
+	fmt.Printf("Do you want to continue? (y/N): ")
+	reader := bufio.NewReader(os.Stdin)
+	response, err := reader.ReadString('\n')
+	if err != nil {
+		return false
+	}
+	response = strings.ToLower(strings.TrimSpace(response))
+	return response == "y" || response == "yes"
+}
+
+// applyNodeDebugSpec pins the debug pod to nodeName, joins the host
+// namespaces, tolerates every taint and mounts the host root filesystem.
+func (d *Debugger) applyNodeDebugSpec(pod *corev1.Pod) {
+	if len(validation.IsValidLabelValue(d.Node)) == 0 {
+		pod.Labels["debug-tool/node"] = d.Node
+	}
+
+	spec := &pod.Spec
+	spec.NodeName = d.Node
+	spec.HostPID = true
+	spec.HostNetwork = true
+	spec.HostIPC = true
+	spec.DNSPolicy = corev1.DNSClusterFirstWithHostNet
+	spec.Tolerations = []corev1.Toleration{
+		{Operator: corev1.TolerationOpExists},
+	}
+	spec.Volumes = append(spec.Volumes, corev1.Volume{
+		Name: "host-root",
+		VolumeSource: corev1.VolumeSource{
+			HostPath: &corev1.HostPathVolumeSource{Path: "/"},
+		},
+	})
+
+	for i := range spec.Containers {
+		container := &spec.Containers[i]
+		container.VolumeMounts = append(container.VolumeMounts, corev1.VolumeMount{
+			Name:      "host-root",
+			MountPath: hostRootMountPath,
+		})
+
+		// Reading the host filesystem needs root
+		if container.SecurityContext != nil {
+			container.SecurityContext.RunAsUser = pointer.Int64(0)
+			container.SecurityContext.RunAsNonRoot = pointer.Bool(false)
+		}
+	}
+}
@@ -0,0 +1,340 @@
+package debug
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"sigs.k8s.io/yaml"
+)
+
+// Key holding the profiles in the cluster ConfigMap
+const profilesConfigMapKey = "profiles.yaml"
+
+// builtinProfiles are the profiles implemented by SecurityContexts
+var builtinProfiles = []string{"general", "restricted", "baseline", "privileged"}
+
+// SecurityProfile is a named set of security settings for the debug container
+type SecurityProfile struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	// Source is where the profile was loaded from
+	Source string `json:"source,omitempty"`
+	// SecurityContext is applied to the debug container
+	SecurityContext *corev1.SecurityContext `json:"securityContext,omitempty"`
+	// PodSecurityContext is applied to standalone debug pods
+	PodSecurityContext *corev1.PodSecurityContext `json:"podSecurityContext,omitempty"`
+	// SeccompProfile and AppArmorProfile apply to both contexts unless they set their own
+	SeccompProfile  *corev1.SeccompProfile  `json:"seccompProfile,omitempty"`
+	AppArmorProfile *corev1.AppArmorProfile `json:"appArmorProfile,omitempty"`
+	// AllowedImages are glob patterns the debug image must match
+	AllowedImages []string `json:"allowedImages,omitempty"`
+	// KubectlProfile was the kubectl debug profile pod copies were based on.
+	// Copies now get the profile's own contexts, it is only accepted so
+	// existing profile files still load.
+	KubectlProfile string `json:"kubectlProfile,omitempty"`
+}
+
+type profileList struct {
+	Profiles []SecurityProfile `json:"profiles"`
+}
+
+// ConfigDir returns ~/.config/kubectl-debug, honoring XDG_CONFIG_HOME
+func ConfigDir() string {
+	base := os.Getenv("XDG_CONFIG_HOME")
+	if base == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return ""
+		}
+		base = filepath.Join(home, ".config")
+	}
+	return filepath.Join(base, "kubectl-debug")
+}
+
+func defaultProfilesFile() string {
+	dir := ConfigDir()
+	if dir == "" {
+		return ""
+	}
+	return filepath.Join(dir, "profiles.yaml")
+}
+
+func isBuiltinProfile(name string) bool {
+	for _, builtin := range builtinProfiles {
+		if name == builtin {
+			return true
+		}
+	}
+	return false
+}
+
+func validateSeccomp(sp *corev1.SeccompProfile) error {
+	if sp == nil {
+		return nil
+	}
+	switch sp.Type {
+	case corev1.SeccompProfileTypeRuntimeDefault, corev1.SeccompProfileTypeUnconfined:
+		return nil
+	case corev1.SeccompProfileTypeLocalhost:
+		if sp.LocalhostProfile == nil || *sp.LocalhostProfile == "" {
+			return fmt.Errorf("seccomp type Localhost requires localhostProfile")
+		}
+		return nil
+	}
+	return fmt.Errorf("invalid seccomp type %q", sp.Type)
+}
+
+func validateAppArmor(ap *corev1.AppArmorProfile) error {
+	if ap == nil {
+		return nil
+	}
+	switch ap.Type {
+	case corev1.AppArmorProfileTypeRuntimeDefault, corev1.AppArmorProfileTypeUnconfined:
+		return nil
+	case corev1.AppArmorProfileTypeLocalhost:
+		if ap.LocalhostProfile == nil || *ap.LocalhostProfile == "" {
+			return fmt.Errorf("apparmor type Localhost requires localhostProfile")
+		}
+		return nil
+	}
+	return fmt.Errorf("invalid apparmor type %q", ap.Type)
+}
+
+// validateProfile checks a user-defined profile
+func validateProfile(p *SecurityProfile) error {
+	if errs := validation.IsDNS1123Label(p.Name); len(errs) > 0 {
+		return fmt.Errorf("invalid profile name %q: %s", p.Name, strings.Join(errs, ", "))
+	}
+	if isBuiltinProfile(p.Name) {
+		return fmt.Errorf("profile %q redefines a built-in profile", p.Name)
+	}
+
+	checks := []error{validateSeccomp(p.SeccompProfile), validateAppArmor(p.AppArmorProfile)}
+	if sc := p.SecurityContext; sc != nil {
+		checks = append(checks, validateSeccomp(sc.SeccompProfile), validateAppArmor(sc.AppArmorProfile))
+	}
+	if psc := p.PodSecurityContext; psc != nil {
+		checks = append(checks, validateSeccomp(psc.SeccompProfile), validateAppArmor(psc.AppArmorProfile))
+	}
+	for _, err := range checks {
+		if err != nil {
+			return fmt.Errorf("profile %q: %v", p.Name, err)
+		}
+	}
+
+	for _, pattern := range p.AllowedImages {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("profile %q: invalid allowed image pattern %q: %v", p.Name, pattern, err)
+		}
+	}
+
+	switch p.KubectlProfile {
+	case "", "legacy", "general", "baseline", "restricted", "netadmin", "sysadmin":
+	default:
+		return fmt.Errorf("profile %q: invalid kubectlProfile %q", p.Name, p.KubectlProfile)
+	}
+	return nil
+}
+
+// parseProfiles reads and validates the profiles in a YAML document
+func parseProfiles(data []byte, source string) ([]SecurityProfile, error) {
+	var list profileList
+	if err := yaml.UnmarshalStrict(data, &list); err != nil {
+		return nil, fmt.Errorf("error parsing profiles from %s: %v", source, err)
+	}
+
+	seen := map[string]bool{}
+	for i := range list.Profiles {
+		p := &list.Profiles[i]
+		if err := validateProfile(p); err != nil {
+			return nil, fmt.Errorf("invalid profile in %s: %v", source, err)
+		}
+		if seen[p.Name] {
+			return nil, fmt.Errorf("invalid profile in %s: profile %q is defined twice", source, p.Name)
+		}
+		seen[p.Name] = true
+		p.Source = source
+	}
+	return list.Profiles, nil
+}
+
+// loadClusterProfiles reads the profiles ConfigMap. A missing ConfigMap, or
+// one the user may not read, is not an error.
+func (d *Debugger) loadClusterProfiles(ctx context.Context) ([]SecurityProfile, error) {
+	if d.ProfilesConfigMap == "" {
+		return nil, nil
+	}
+
+	cmNamespace, cmName, found := strings.Cut(d.ProfilesConfigMap, "/")
+	if !found {
+		cmNamespace, cmName = d.Namespace, d.ProfilesConfigMap
+	}
+
+	client, err := d.getClient()
+	if err != nil {
+		d.logf("Warning: Could not read profiles ConfigMap %s/%s: %v", cmNamespace, cmName, err)
+		return nil, nil
+	}
+	cm, err := client.CoreV1().ConfigMaps(cmNamespace).Get(ctx, cmName, metav1.GetOptions{})
+	switch {
+	case apierrors.IsNotFound(err), apierrors.IsForbidden(err):
+		return nil, nil
+	case err != nil:
+		d.logf("Warning: Could not read profiles ConfigMap %s/%s: %v", cmNamespace, cmName, err)
+		return nil, nil
+	}
+
+	return parseProfiles([]byte(cm.Data[profilesConfigMapKey]), fmt.Sprintf("configmap/%s/%s", cmNamespace, cmName))
+}
+
+// LoadProfiles loads the built-in profiles, those in the cluster ConfigMap
+// and those in the user's profiles file, which take precedence.
+func (d *Debugger) LoadProfiles(ctx context.Context) error {
+	profiles := map[string]*SecurityProfile{}
+	for _, name := range builtinProfiles {
+		containerContext, podContext := d.SecurityContexts(name)
+		profiles[name] = &SecurityProfile{
+			Name:               name,
+			Source:             "built-in",
+			SecurityContext:    containerContext,
+			PodSecurityContext: podContext,
+		}
+	}
+
+	// Profiles shipped by the platform team in the cluster
+	clusterProfiles, err := d.loadClusterProfiles(ctx)
+	if err != nil {
+		return err
+	}
+	for i := range clusterProfiles {
+		profiles[clusterProfiles[i].Name] = &clusterProfiles[i]
+	}
+
+	// Profiles defined by the user
+	if d.ProfilesFile != "" {
+		data, err := os.ReadFile(d.ProfilesFile)
+		switch {
+		case os.IsNotExist(err):
+		case err != nil:
+			return fmt.Errorf("error reading profiles file: %v", err)
+		default:
+			userProfiles, err := parseProfiles(data, d.ProfilesFile)
+			if err != nil {
+				return err
+			}
+			for i := range userProfiles {
+				profiles[userProfiles[i].Name] = &userProfiles[i]
+			}
+		}
+	}
+
+	d.profiles = profiles
+	return nil
+}
+
+// lookupProfile returns a loaded profile by name
+func (d *Debugger) lookupProfile(name string) (*SecurityProfile, bool) {
+	if d.profiles == nil {
+		if !isBuiltinProfile(name) {
+			return nil, false
+		}
+		containerContext, podContext := d.SecurityContexts(name)
+		return &SecurityProfile{Name: name, Source: "built-in", SecurityContext: containerContext, PodSecurityContext: podContext}, true
+	}
+	p, ok := d.profiles[name]
+	return p, ok
+}
+
+// customProfileContexts returns copies of a user-defined profile's contexts
+// with the seccomp and AppArmor shortcuts applied.
+func customProfileContexts(p *SecurityProfile) (*corev1.SecurityContext, *corev1.PodSecurityContext) {
+	containerContext := &corev1.SecurityContext{}
+	if p.SecurityContext != nil {
+		containerContext = p.SecurityContext.DeepCopy()
+	}
+	podContext := &corev1.PodSecurityContext{}
+	if p.PodSecurityContext != nil {
+		podContext = p.PodSecurityContext.DeepCopy()
+	}
+
+	seccomp := p.SeccompProfile
+	if seccomp == nil {
+		seccomp = &corev1.SeccompProfile{Type: corev1.SeccompProfileTypeRuntimeDefault}
+	}
+	if containerContext.SeccompProfile == nil {
+		containerContext.SeccompProfile = seccomp.DeepCopy()
+	}
+	if podContext.SeccompProfile == nil {
+		podContext.SeccompProfile = seccomp.DeepCopy()
+	}
+
+	if p.AppArmorProfile != nil {
+		if containerContext.AppArmorProfile == nil {
+			containerContext.AppArmorProfile = p.AppArmorProfile.DeepCopy()
+		}
+		if podContext.AppArmorProfile == nil {
+			podContext.AppArmorProfile = p.AppArmorProfile.DeepCopy()
+		}
+	}
+	return containerContext, podContext
+}
+
+// validateProfileSelection checks that the selected profile exists and allows the image
+func (d *Debugger) validateProfileSelection() error {
+	if d.Profile == "" {
+		return nil
+	}
+
+	p, ok := d.lookupProfile(d.Profile)
+	if !ok {
+		names := make([]string, 0, len(d.profiles))
+		for name := range d.profiles {
+			names = append(names, name)
+		}
+		if len(names) == 0 {
+			names = builtinProfiles
+		}
+		sort.Strings(names)
+		return fmt.Errorf("invalid profile %q: must be one of: %s", d.Profile, strings.Join(names, ", "))
+	}
+
+	if len(p.AllowedImages) == 0 {
+		return nil
+	}
+	for _, pattern := range p.AllowedImages {
+		if matched, _ := path.Match(pattern, d.Image); matched {
+			return nil
+		}
+	}
+	return fmt.Errorf("image %q is not allowed by profile %q (allowed: %s)", d.Image, d.Profile, strings.Join(p.AllowedImages, ", "))
+}
+
+// Profiles returns the loaded profiles sorted by name
+func (d *Debugger) Profiles() []SecurityProfile {
+	profiles := make([]SecurityProfile, 0, len(d.profiles))
+	for _, p := range d.profiles {
+		profiles = append(profiles, *p)
+	}
+	sort.Slice(profiles, func(i, j int) bool { return profiles[i].Name < profiles[j].Name })
+	return profiles
+}
+
+// Export functions for testing
+func (d *Debugger) SetProfileSources(file, configMap string) {
+	d.ProfilesFile = file
+	d.ProfilesConfigMap = configMap
+	d.profiles = nil
+}
+
+func (d *Debugger) ValidateProfileSelection() error {
+	return d.validateProfileSelection()
+}
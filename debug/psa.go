@@ -0,0 +1,392 @@
+package debug
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Namespace label holding the enforced Pod Security Standard
+const psaEnforceLabel = "pod-security.kubernetes.io/enforce"
+
+const (
+	psaPrivileged = "privileged"
+	psaBaseline   = "baseline"
+	psaRestricted = "restricted"
+)
+
+// Built-in profiles from the most to the least capable, to find a
+// replacement the namespace allows
+var profileStrength = []string{"privileged", "general", "baseline", "restricted"}
+
+var (
+	// Capabilities the baseline standard allows to add
+	baselineCapabilities = map[corev1.Capability]bool{
+		"AUDIT_WRITE": true, "CHOWN": true, "DAC_OVERRIDE": true, "FOWNER": true,
+		"FSETID": true, "KILL": true, "MKNOD": true, "NET_BIND_SERVICE": true,
+		"SETFCAP": true, "SETGID": true, "SETPCAP": true, "SETUID": true, "SYS_CHROOT": true,
+	}
+	// Sysctls the baseline standard considers safe
+	baselineSysctls = map[string]bool{
+		"kernel.shm_rmid_forced": true, "net.ipv4.ip_local_port_range": true,
+		"net.ipv4.ip_unprivileged_port_start": true, "net.ipv4.tcp_syncookies": true,
+		"net.ipv4.ping_group_range": true, "net.ipv4.ip_local_reserved_ports": true,
+		"net.ipv4.tcp_keepalive_time": true, "net.ipv4.tcp_fin_timeout": true,
+		"net.ipv4.tcp_keepalive_intvl": true, "net.ipv4.tcp_keepalive_probes": true,
+	}
+	// SELinux types the baseline standard allows
+	baselineSELinuxTypes = map[string]bool{
+		"": true, "container_t": true, "container_init_t": true, "container_kvm_t": true, "container_engine_t": true,
+	}
+)
+
+// psaContainer is a container of any kind with the path of its spec
+type psaContainer struct {
+	path            string
+	securityContext *corev1.SecurityContext
+	ports           []corev1.ContainerPort
+}
+
+func podContainers(pod *corev1.Pod) []psaContainer {
+	var containers []psaContainer
+	for i, c := range pod.Spec.InitContainers {
+		containers = append(containers, psaContainer{fmt.Sprintf("spec.initContainers[%d]", i), c.SecurityContext, c.Ports})
+	}
+	for i, c := range pod.Spec.Containers {
+		containers = append(containers, psaContainer{fmt.Sprintf("spec.containers[%d]", i), c.SecurityContext, c.Ports})
+	}
+	for i, c := range pod.Spec.EphemeralContainers {
+		containers = append(containers, psaContainer{fmt.Sprintf("spec.ephemeralContainers[%d]", i), c.SecurityContext, c.Ports})
+	}
+	return containers
+}
+
+// checkPodSecurity evaluates pod against a Pod Security Standard level and
+// returns one entry per violating field
+func checkPodSecurity(pod *corev1.Pod, level string) []string {
+	switch level {
+	case psaBaseline:
+		return checkBaseline(pod)
+	case psaRestricted:
+		return append(checkBaseline(pod), checkRestricted(pod)...)
+	}
+	return nil
+}
+
+func checkBaseline(pod *corev1.Pod) []string {
+	var violations []string
+	add := func(field, format string, args ...interface{}) {
+		violations = append(violations, field+": "+fmt.Sprintf(format, args...))
+	}
+
+	spec := &pod.Spec
+	if spec.HostNetwork {
+		add("spec.hostNetwork", "host network is not allowed")
+	}
+	if spec.HostPID {
+		add("spec.hostPID", "host PID namespace is not allowed")
+	}
+	if spec.HostIPC {
+		add("spec.hostIPC", "host IPC namespace is not allowed")
+	}
+	for i, v := range spec.Volumes {
+		if v.HostPath != nil {
+			add(fmt.Sprintf("spec.volumes[%d].hostPath", i), "hostPath volume %s is not allowed", v.Name)
+		}
+	}
+
+	if psc := spec.SecurityContext; psc != nil {
+		if psc.WindowsOptions != nil && psc.WindowsOptions.HostProcess != nil && *psc.WindowsOptions.HostProcess {
+			add("spec.securityContext.windowsOptions.hostProcess", "host processes are not allowed")
+		}
+		if psc.SeccompProfile != nil && psc.SeccompProfile.Type == corev1.SeccompProfileTypeUnconfined {
+			add("spec.securityContext.seccompProfile.type", "Unconfined is not allowed")
+		}
+		if psc.AppArmorProfile != nil && psc.AppArmorProfile.Type == corev1.AppArmorProfileTypeUnconfined {
+			add("spec.securityContext.appArmorProfile.type", "Unconfined is not allowed")
+		}
+		if se := psc.SELinuxOptions; se != nil {
+			if !baselineSELinuxTypes[se.Type] {
+				add("spec.securityContext.seLinuxOptions.type", "%s is not allowed", se.Type)
+			}
+			if se.User != "" || se.Role != "" {
+				add("spec.securityContext.seLinuxOptions", "setting user or role is not allowed")
+			}
+		}
+		for i, s := range psc.Sysctls {
+			if !baselineSysctls[s.Name] {
+				add(fmt.Sprintf("spec.securityContext.sysctls[%d]", i), "sysctl %s is not allowed", s.Name)
+			}
+		}
+	}
+
+	for name, value := range pod.Annotations {
+		if strings.HasPrefix(name, corev1.DeprecatedAppArmorBetaContainerAnnotationKeyPrefix) &&
+			value != corev1.DeprecatedAppArmorBetaProfileRuntimeDefault && !strings.HasPrefix(value, corev1.DeprecatedAppArmorBetaProfileNamePrefix) {
+			add("metadata.annotations["+name+"]", "AppArmor profile %s is not allowed", value)
+		}
+	}
+
+	for _, c := range podContainers(pod) {
+		for i, port := range c.ports {
+			if port.HostPort != 0 {
+				add(fmt.Sprintf("%s.ports[%d].hostPort", c.path, i), "host port %d is not allowed", port.HostPort)
+			}
+		}
+
+		sc := c.securityContext
+		if sc == nil {
+			continue
+		}
+		path := c.path + ".securityContext"
+		if sc.Privileged != nil && *sc.Privileged {
+			add(path+".privileged", "privileged containers are not allowed")
+		}
+		if sc.WindowsOptions != nil && sc.WindowsOptions.HostProcess != nil && *sc.WindowsOptions.HostProcess {
+			add(path+".windowsOptions.hostProcess", "host processes are not allowed")
+		}
+		if sc.Capabilities != nil {
+			for _, capability := range sc.Capabilities.Add {
+				if !baselineCapabilities[capability] {
+					add(path+".capabilities.add", "capability %s is not allowed", capability)
+				}
+			}
+		}
+		if sc.SeccompProfile != nil && sc.SeccompProfile.Type == corev1.SeccompProfileTypeUnconfined {
+			add(path+".seccompProfile.type", "Unconfined is not allowed")
+		}
+		if sc.AppArmorProfile != nil && sc.AppArmorProfile.Type == corev1.AppArmorProfileTypeUnconfined {
+			add(path+".appArmorProfile.type", "Unconfined is not allowed")
+		}
+		if se := sc.SELinuxOptions; se != nil {
+			if !baselineSELinuxTypes[se.Type] {
+				add(path+".seLinuxOptions.type", "%s is not allowed", se.Type)
+			}
+			if se.User != "" || se.Role != "" {
+				add(path+".seLinuxOptions", "setting user or role is not allowed")
+			}
+		}
+		if sc.ProcMount != nil && *sc.ProcMount != corev1.DefaultProcMount {
+			add(path+".procMount", "%s is not allowed", *sc.ProcMount)
+		}
+	}
+	return violations
+}
+
+func checkRestricted(pod *corev1.Pod) []string {
+	var violations []string
+	add := func(field, format string, args ...interface{}) {
+		violations = append(violations, field+": "+fmt.Sprintf(format, args...))
+	}
+
+	for i, v := range pod.Spec.Volumes {
+		src := v.VolumeSource
+		allowed := src.ConfigMap != nil || src.CSI != nil || src.DownwardAPI != nil || src.EmptyDir != nil ||
+			src.Ephemeral != nil || src.PersistentVolumeClaim != nil || src.Projected != nil || src.Secret != nil
+		if !allowed && src.HostPath == nil { // hostPath is already reported by baseline
+			add(fmt.Sprintf("spec.volumes[%d]", i), "volume type of %s is not allowed", v.Name)
+		}
+	}
+
+	psc := pod.Spec.SecurityContext
+	if psc == nil {
+		psc = &corev1.PodSecurityContext{}
+	}
+	podNonRoot := psc.RunAsNonRoot != nil && *psc.RunAsNonRoot
+	podSeccomp := psc.SeccompProfile != nil &&
+		(psc.SeccompProfile.Type == corev1.SeccompProfileTypeRuntimeDefault || psc.SeccompProfile.Type == corev1.SeccompProfileTypeLocalhost)
+	if psc.RunAsNonRoot != nil && !*psc.RunAsNonRoot {
+		add("spec.securityContext.runAsNonRoot", "must not be false")
+	}
+	if psc.RunAsUser != nil && *psc.RunAsUser == 0 {
+		add("spec.securityContext.runAsUser", "must not be 0")
+	}
+
+	for _, c := range podContainers(pod) {
+		sc := c.securityContext
+		if sc == nil {
+			sc = &corev1.SecurityContext{}
+		}
+		path := c.path + ".securityContext"
+
+		if sc.AllowPrivilegeEscalation == nil || *sc.AllowPrivilegeEscalation {
+			add(path+".allowPrivilegeEscalation", "must be false")
+		}
+		switch {
+		case sc.RunAsNonRoot != nil && !*sc.RunAsNonRoot:
+			add(path+".runAsNonRoot", "must not be false")
+		case sc.RunAsNonRoot == nil && !podNonRoot:
+			add(path+".runAsNonRoot", "must be true on the container or the pod")
+		}
+		if sc.RunAsUser != nil && *sc.RunAsUser == 0 {
+			add(path+".runAsUser", "must not be 0")
+		}
+		if sc.SeccompProfile == nil {
+			if !podSeccomp {
+				add(path+".seccompProfile.type", "must be RuntimeDefault or Localhost on the container or the pod")
+			}
+		} else if sc.SeccompProfile.Type != corev1.SeccompProfileTypeRuntimeDefault && sc.SeccompProfile.Type != corev1.SeccompProfileTypeLocalhost {
+			add(path+".seccompProfile.type", "must be RuntimeDefault or Localhost")
+		}
+
+		dropsAll := false
+		if sc.Capabilities != nil {
+			for _, capability := range sc.Capabilities.Drop {
+				if capability == "ALL" {
+					dropsAll = true
+				}
+			}
+			for _, capability := range sc.Capabilities.Add {
+				if capability != "NET_BIND_SERVICE" && baselineCapabilities[capability] {
+					add(path+".capabilities.add", "capability %s is not allowed", capability)
+				}
+			}
+		}
+		if !dropsAll {
+			add(path+".capabilities.drop", "must include ALL")
+		}
+	}
+	return violations
+}
+
+// namespacePSALevel returns the Pod Security Standard enforced in the namespace
+func (d *Debugger) namespacePSALevel(ctx context.Context) (string, error) {
+	client, err := d.getClient()
+	if err != nil {
+		return "", err
+	}
+	ns, err := client.CoreV1().Namespaces().Get(ctx, d.Namespace, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		// Creating the pod will report the missing namespace
+		return psaPrivileged, nil
+	}
+	if err != nil {
+		return "", err
+	}
+	switch level := ns.Labels[psaEnforceLabel]; level {
+	case psaBaseline, psaRestricted:
+		return level, nil
+	}
+	return psaPrivileged, nil
+}
+
+// podSecurityPreflight checks the pod that build generates against the
+// namespace's enforced Pod Security Standard. When it would be rejected the
+// violations are reported and the strongest built-in profile that the
+// namespace allows is offered instead.
+func (d *Debugger) podSecurityPreflight(ctx context.Context, build func() (*corev1.Pod, error)) error {
+	level, err := d.namespacePSALevel(ctx)
+	if err != nil {
+		if apierrors.IsForbidden(err) {
+			d.logf("Warning: Not allowed to read namespace %s, skipping the Pod Security check", d.Namespace)
+			return nil
+		}
+		return fmt.Errorf("error reading Pod Security level of namespace %s: %v", d.Namespace, err)
+	}
+	if level == psaPrivileged {
+		return nil
+	}
+
+	pod, err := d.quietBuild(build)
+	if err != nil {
+		return err
+	}
+	violations := checkPodSecurity(pod, level)
+	if len(violations) == 0 {
+		return nil
+	}
+
+	d.logf("Profile %s violates the %s Pod Security Standard enforced in namespace %s:", d.profileName(), level, d.Namespace)
+	for _, v := range violations {
+		d.logf("  %s", v)
+	}
+
+	alternative := ""
+	if d.Node == "" {
+		alternative, err = d.allowedProfile(build, level)
+		if err != nil {
+			return err
+		}
+	}
+	if alternative == "" {
+		return fmt.Errorf("no built-in profile is allowed by the %s Pod Security Standard of namespace %s", level, d.Namespace)
+	}
+
+	if d.DryRun {
+		d.logf("Warning: The debug pod would be rejected, profile %s is allowed", alternative)
+		return nil
+	}
+	if !d.askForProfile(alternative) {
+		return fmt.Errorf("profile %s is not allowed in namespace %s", d.profileName(), d.Namespace)
+	}
+	d.logf("Using profile %s", alternative)
+	d.Profile = alternative
+	return nil
+}
+
+// allowedProfile returns the most capable built-in profile whose pod passes
+// the level, leaving the selected profile unchanged
+func (d *Debugger) allowedProfile(build func() (*corev1.Pod, error), level string) (string, error) {
+	selected, current := d.Profile, d.profileName()
+	defer func() { d.Profile = selected }()
+
+	for _, candidate := range profileStrength {
+		if candidate == current {
+			continue
+		}
+		d.Profile = candidate
+		pod, err := d.quietBuild(build)
+		if err != nil {
+			return "", err
+		}
+		if len(checkPodSecurity(pod, level)) == 0 {
+			return candidate, nil
+		}
+	}
+	return "", nil
+}
+
+// quietBuild runs build without its progress messages, the pod is only a preview
+func (d *Debugger) quietBuild(build func() (*corev1.Pod, error)) (*corev1.Pod, error) {
+	quiet := d.quiet
+	d.quiet = true
+	defer func() { d.quiet = quiet }()
+	return build()
+}
+
+// ephemeralPodPreview returns the target pod with the ephemeral debug
+// container added, which is what admission evaluates
+func (d *Debugger) ephemeralPodPreview(ctx context.Context, targetPod *corev1.Pod, target *corev1.Container) (*corev1.Pod, error) {
+	ec, err := d.buildEphemeralContainer(ctx, targetPod, target)
+	if err != nil {
+		return nil, err
+	}
+	pod := targetPod.DeepCopy()
+	pod.Spec.EphemeralContainers = append(pod.Spec.EphemeralContainers, *ec)
+	return pod, nil
+}
+
+func (d *Debugger) askForProfile(alternative string) bool {
+	if d.Force {
+		return true
+	}
+	fmt.Printf("Use profile '%s' instead? (y/N): ", alternative)
+	reader := bufio.NewReader(os.Stdin)
+	response, err := reader.ReadString('\n')
+	if err != nil {
+		return false
+	}
+	response = strings.ToLower(strings.TrimSpace(response))
+	return response == "y" || response == "yes"
+}
+
+// Export functions for testing
+func CheckPodSecurity(pod *corev1.Pod, level string) []string {
+	return checkPodSecurity(pod, level)
+}
@@ -0,0 +1,200 @@
+package debug
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"text/tabwriter"
+
+	authorizationv1 "k8s.io/api/authorization/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// accessCheck is a permission one of the debug paths needs in the namespace
+type accessCheck struct {
+	verb        string
+	resource    string
+	subresource string
+	purpose     string
+}
+
+func (c accessCheck) resourceName() string {
+	if c.subresource != "" {
+		return c.resource + "/" + c.subresource
+	}
+	return c.resource
+}
+
+// accessDenial is a failed check with the reason reported by the authorizer
+type accessDenial struct {
+	accessCheck
+	reason string
+}
+
+// Debug modes, each needs its own set of permissions
+const (
+	ModeStandalone = "standalone"
+	ModeCopy       = "copy"
+	ModeEphemeral  = "ephemeral"
+)
+
+var debugModes = []string{ModeStandalone, ModeCopy, ModeEphemeral}
+
+// debugMode returns the mode the flags select: a standalone or node pod, a
+// pod copy, or an ephemeral container
+func (d *Debugger) debugMode() string {
+	switch {
+	case d.Pod == "":
+		return ModeStandalone
+	case d.copies():
+		return ModeCopy
+	}
+	return ModeEphemeral
+}
+
+// requiredAccess returns the permissions the selected debug mode needs
+func (d *Debugger) requiredAccess() []accessCheck {
+	connect := ""
+	switch {
+	case d.isRunMode():
+		connect = "exec"
+	case d.Interactive && d.TTY:
+		connect = "attach"
+	}
+	return d.requiredAccessFor(d.debugMode(), connect, d.RemoveAfter)
+}
+
+// connectCheck is the permission to reach the debugger in what: attach for
+// a session, exec to run a command
+func connectCheck(connect, what string) accessCheck {
+	if connect == "exec" {
+		return accessCheck{"create", "pods", "exec", "run the command in " + what}
+	}
+	return accessCheck{"create", "pods", "attach", "attach to " + what}
+}
+
+// requiredAccessFor returns the permissions mode needs. connect is the pods
+// subresource used to reach the debugger (attach or exec), empty when the
+// tool does not connect to it.
+func (d *Debugger) requiredAccessFor(mode, connect string, remove bool) []accessCheck {
+	var checks []accessCheck
+	session := connect != ""
+
+	switch mode {
+	case ModeStandalone:
+		checks = append(checks, accessCheck{"create", "pods", "", "create the debug pod"})
+		if session {
+			checks = append(checks, connectCheck(connect, "the debug pod"))
+		}
+		if remove {
+			checks = append(checks, accessCheck{"delete", "pods", "", "remove the debug pod (--rm)"})
+		}
+
+	case ModeCopy:
+		checks = append(checks,
+			accessCheck{"get", "pods", "", "read the target pod"},
+			accessCheck{"list", "pods", "", "find a pod copy to reuse"},
+			accessCheck{"create", "pods", "", "create the pod copy"},
+		)
+		if session {
+			checks = append(checks, connectCheck(connect, "the pod copy"))
+			// A reused pod copy is entered with a new shell
+			if connect != "exec" {
+				checks = append(checks, accessCheck{"create", "pods", "exec", "start a shell in a reused pod copy"})
+			}
+		}
+		if remove {
+			checks = append(checks, accessCheck{"delete", "pods", "", "remove the pod copy (--rm)"})
+		}
+
+	case ModeEphemeral:
+		checks = append(checks,
+			accessCheck{"get", "pods", "", "read the target pod"},
+			accessCheck{"patch", "pods", "ephemeralcontainers", "add the debug container"},
+		)
+		if session {
+			checks = append(checks, connectCheck(connect, "the debug container"))
+			if remove && connect != "exec" {
+				checks = append(checks, accessCheck{"create", "pods", "exec", "stop the debug container (--rm)"})
+			}
+		}
+	}
+	return checks
+}
+
+// missingAccess asks the API server which of the checks the user fails
+func (d *Debugger) missingAccess(ctx context.Context, checks []accessCheck) ([]accessDenial, error) {
+	client, err := d.getClient()
+	if err != nil {
+		return nil, err
+	}
+
+	var denied []accessDenial
+	for _, check := range checks {
+		review := &authorizationv1.SelfSubjectAccessReview{
+			Spec: authorizationv1.SelfSubjectAccessReviewSpec{
+				ResourceAttributes: &authorizationv1.ResourceAttributes{
+					Namespace:   d.Namespace,
+					Verb:        check.verb,
+					Resource:    check.resource,
+					Subresource: check.subresource,
+				},
+			},
+		}
+		result, err := client.AuthorizationV1().SelfSubjectAccessReviews().Create(ctx, review, metav1.CreateOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("error checking %s %s: %v", check.verb, check.resourceName(), err)
+		}
+		if !result.Status.Allowed {
+			denied = append(denied, accessDenial{check, firstNonEmpty(result.Status.Reason, result.Status.EvaluationError)})
+		}
+	}
+	return denied, nil
+}
+
+// formatDenials renders the missing permissions as a table
+func formatDenials(denied []accessDenial) string {
+	var b strings.Builder
+	w := tabwriter.NewWriter(&b, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(w, "VERB\tRESOURCE\tNEEDED TO\tREASON")
+	for _, d := range denied {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", d.verb, d.resourceName(), d.purpose, d.reason)
+	}
+	w.Flush()
+	return b.String()
+}
+
+// rbacPreflight checks every permission the debug path needs before it
+// starts, so a limited role fails with the full list instead of halfway
+// through with a forbidden error
+func (d *Debugger) rbacPreflight(ctx context.Context, checks []accessCheck) error {
+	denied, err := d.missingAccess(ctx, checks)
+	if err != nil {
+		// Access reviews only help, the actual requests are still authorized
+		d.logf("Warning: Could not check permissions: %v", err)
+		return nil
+	}
+	if len(denied) == 0 {
+		return nil
+	}
+
+	user := d.currentUser(ctx)
+	if user == "" {
+		user = "the current user"
+	}
+	d.logf("Missing permissions for %s in namespace %s:\n%s", user, d.Namespace, formatDenials(denied))
+	if d.DryRun {
+		d.logf("Warning: The debug session would fail with these permissions")
+		return nil
+	}
+	return fmt.Errorf("%d required permission(s) missing in namespace %s", len(denied), d.Namespace)
+}
+
+// Export functions for testing
+func (d *Debugger) RequiredAccess() []string {
+	var checks []string
+	for _, c := range d.requiredAccess() {
+		checks = append(checks, c.verb+" "+c.resourceName())
+	}
+	return checks
+}
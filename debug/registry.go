@@ -0,0 +1,253 @@
+package debug
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// labelRunAsRoot is set by the debug images to tell the root and nonroot
+// variants apart
+const labelRunAsRoot = "container.run.as.root"
+
+// registryClient reads image manifests and configs from registries
+var registryClient = &http.Client{Timeout: 10 * time.Second}
+
+// maxIndexLevels is the number of image indexes followed to reach a
+// manifest, registries only serve indexes of manifests
+const maxIndexLevels = 1
+
+var manifestMediaTypes = []string{
+	"application/vnd.oci.image.index.v1+json",
+	"application/vnd.docker.distribution.manifest.list.v2+json",
+	"application/vnd.oci.image.manifest.v1+json",
+	"application/vnd.docker.distribution.manifest.v2+json",
+}
+
+// imageManifest is the part of image indexes and manifests needed to reach
+// the image config
+type imageManifest struct {
+	Manifests []struct {
+		Digest   string `json:"digest"`
+		Platform struct {
+			OS           string `json:"os"`
+			Architecture string `json:"architecture"`
+		} `json:"platform"`
+	} `json:"manifests"`
+	Config struct {
+		Digest string `json:"digest"`
+	} `json:"config"`
+}
+
+// imageReference is an image split into what the registry API needs
+type imageReference struct {
+	registry   string
+	repository string
+	reference  string
+}
+
+func parseImageReference(image string) imageReference {
+	// normalizeImage always yields REGISTRY/REPOSITORY followed by :TAG or @DIGEST
+	name := normalizeImage(image)
+	var ref imageReference
+	if i := strings.Index(name, "@"); i >= 0 {
+		name, ref.reference = name[:i], name[i+1:]
+	} else {
+		i := strings.LastIndex(name, ":")
+		name, ref.reference = name[:i], name[i+1:]
+	}
+	ref.registry, ref.repository, _ = strings.Cut(name, "/")
+	if ref.registry == "docker.io" {
+		ref.registry = "registry-1.docker.io"
+	}
+	return ref
+}
+
+func (r imageReference) url(kind, reference string) string {
+	scheme := "https"
+	// Local registries are plain HTTP, as container runtimes assume
+	host := strings.Split(r.registry, ":")[0]
+	if host == "localhost" || host == "127.0.0.1" {
+		scheme = "http"
+	}
+	return fmt.Sprintf("%s://%s/v2/%s/%s/%s", scheme, r.registry, r.repository, kind, reference)
+}
+
+// registryRequest gets registry resources, with an anonymous pull token
+// when the registry asks for one
+type registryRequest struct {
+	ref   imageReference
+	token string
+}
+
+func (r *registryRequest) get(ctx context.Context, target string, accept ...string) ([]byte, error) {
+	resp, body, err := r.fetch(ctx, target, accept)
+	if err == nil && resp.StatusCode == http.StatusUnauthorized {
+		if err := r.authenticate(ctx, resp.Header.Get("WWW-Authenticate")); err != nil {
+			return nil, err
+		}
+		resp, body, err = r.fetch(ctx, target, accept)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s returned %s", target, resp.Status)
+	}
+	return body, nil
+}
+
+func (r *registryRequest) fetch(ctx context.Context, target string, accept []string) (*http.Response, []byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	req.Header.Set("Accept", strings.Join(accept, ", "))
+	if r.token != "" {
+		req.Header.Set("Authorization", "Bearer "+r.token)
+	}
+
+	resp, err := registryClient.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 4<<20))
+	return resp, body, err
+}
+
+// authenticate gets an anonymous pull token from the realm of a Bearer challenge
+func (r *registryRequest) authenticate(ctx context.Context, challenge string) error {
+	scheme, params, _ := strings.Cut(challenge, " ")
+	if !strings.EqualFold(scheme, "Bearer") {
+		return fmt.Errorf("registry %s requires credentials", r.ref.registry)
+	}
+	values := map[string]string{}
+	for _, param := range strings.Split(params, ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(param), "=")
+		values[key] = strings.Trim(value, `"`)
+	}
+	if values["realm"] == "" {
+		return fmt.Errorf("registry %s sent a challenge without realm", r.ref.registry)
+	}
+
+	query := url.Values{}
+	if values["service"] != "" {
+		query.Set("service", values["service"])
+	}
+	query.Set("scope", "repository:"+r.ref.repository+":pull")
+
+	resp, body, err := r.fetch(ctx, values["realm"]+"?"+query.Encode(), []string{"application/json"})
+	if err == nil && resp.StatusCode != http.StatusOK {
+		err = fmt.Errorf("%s returned %s", values["realm"], resp.Status)
+	}
+	if err != nil {
+		return fmt.Errorf("error getting registry token: %v", err)
+	}
+	var token struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.Unmarshal(body, &token); err != nil {
+		return fmt.Errorf("error parsing registry token: %v", err)
+	}
+	r.token = token.Token
+	if r.token == "" {
+		r.token = token.AccessToken
+	}
+	return nil
+}
+
+// imageConfig is the part of an image config kubectl-debug reads
+type imageConfig struct {
+	Labels     map[string]string `json:"Labels"`
+	Entrypoint []string          `json:"Entrypoint"`
+	Cmd        []string          `json:"Cmd"`
+}
+
+// readImageConfig reads the config of an image from its registry, from the
+// linux/amd64 image of multi-platform images
+func readImageConfig(ctx context.Context, image string) (*imageConfig, error) {
+	ref := parseImageReference(image)
+	r := &registryRequest{ref: ref}
+
+	var manifest imageManifest
+	reference := ref.reference
+	for level := 0; ; level++ {
+		body, err := r.get(ctx, ref.url("manifests", reference), manifestMediaTypes...)
+		if err != nil {
+			return nil, err
+		}
+		manifest = imageManifest{}
+		if err := json.Unmarshal(body, &manifest); err != nil {
+			return nil, fmt.Errorf("error parsing manifest of %s: %v", image, err)
+		}
+		if len(manifest.Manifests) == 0 {
+			break
+		}
+		if level == maxIndexLevels {
+			return nil, fmt.Errorf("manifest of %s nests more than %d image index", image, maxIndexLevels)
+		}
+
+		// The variants of an index only differ by platform, any linux one will do
+		reference = ""
+		for _, m := range manifest.Manifests {
+			if m.Platform.OS != "linux" {
+				continue
+			}
+			if reference == "" || m.Platform.Architecture == "amd64" {
+				reference = m.Digest
+			}
+		}
+		if reference == "" {
+			return nil, fmt.Errorf("image %s has no linux variant", image)
+		}
+	}
+	if manifest.Config.Digest == "" {
+		return nil, fmt.Errorf("manifest of %s has no config", image)
+	}
+
+	body, err := r.get(ctx, ref.url("blobs", manifest.Config.Digest), "application/json")
+	if err != nil {
+		return nil, err
+	}
+	var config struct {
+		Config imageConfig `json:"config"`
+	}
+	if err := json.Unmarshal(body, &config); err != nil {
+		return nil, fmt.Errorf("error parsing config of %s: %v", image, err)
+	}
+	return &config.Config, nil
+}
+
+// imageLabels reads the labels of an image from its registry
+func imageLabels(ctx context.Context, image string) (map[string]string, error) {
+	config, err := readImageConfig(ctx, image)
+	if err != nil {
+		return nil, err
+	}
+	return config.Labels, nil
+}
+
+// imageRunsAsRoot reads the container.run.as.root label of an image
+func imageRunsAsRoot(ctx context.Context, image string) (bool, error) {
+	labels, err := imageLabels(ctx, image)
+	if err != nil {
+		return false, err
+	}
+	value, ok := labels[labelRunAsRoot]
+	if !ok {
+		return false, fmt.Errorf("image %s has no %s label", image, labelRunAsRoot)
+	}
+	root, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("invalid %s label %q on %s", labelRunAsRoot, value, image)
+	}
+	return root, nil
+}
@@ -0,0 +1,389 @@
+package debug
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// qosClasses are the accepted --qos values
+var qosClasses = []string{"guaranteed", "burstable", "besteffort"}
+
+// resourceFlag ties a resource flag to the value it sets
+type resourceFlag struct {
+	flag     string
+	value    string
+	resource corev1.ResourceName
+	limit    bool
+}
+
+func (d *Debugger) resourceFlags() []resourceFlag {
+	return []resourceFlag{
+		{flag: "--cpu-request", value: d.CPURequest, resource: corev1.ResourceCPU},
+		{flag: "--memory-request", value: d.MemoryRequest, resource: corev1.ResourceMemory},
+		{flag: "--memory-limit", value: d.MemoryLimit, resource: corev1.ResourceMemory, limit: true},
+		{flag: "--cpu-limit", value: d.CPULimit, resource: corev1.ResourceCPU, limit: true},
+		{flag: "--ephemeral-storage-request", value: d.EphemeralStorageRequest, resource: corev1.ResourceEphemeralStorage},
+		{flag: "--ephemeral-storage-limit", value: d.EphemeralStorageLimit, resource: corev1.ResourceEphemeralStorage, limit: true},
+	}
+}
+
+// debugResources parses the resource flags. An empty flag leaves the
+// resource unset.
+func (d *Debugger) debugResources() (corev1.ResourceRequirements, error) {
+	requirements := corev1.ResourceRequirements{
+		Limits:   corev1.ResourceList{},
+		Requests: corev1.ResourceList{},
+	}
+
+	for _, f := range d.resourceFlags() {
+		if f.value == "" {
+			continue
+		}
+		quantity, err := resource.ParseQuantity(f.value)
+		if err != nil {
+			return requirements, fmt.Errorf("invalid %s %q: %v", f.flag, f.value, err)
+		}
+		if quantity.Sign() < 0 {
+			return requirements, fmt.Errorf("invalid %s %q: must not be negative", f.flag, f.value)
+		}
+		if f.limit {
+			requirements.Limits[f.resource] = quantity
+		} else {
+			requirements.Requests[f.resource] = quantity
+		}
+	}
+
+	for name, request := range requirements.Requests {
+		if limit, ok := requirements.Limits[name]; ok && request.Cmp(limit) > 0 {
+			return requirements, fmt.Errorf("%s request %s exceeds its limit %s", name, request.String(), limit.String())
+		}
+	}
+
+	if err := d.applyQoS(&requirements); err != nil {
+		return requirements, err
+	}
+	return requirements, nil
+}
+
+// applyQoS derives the CPU and memory requests and limits for --qos
+func (d *Debugger) applyQoS(requirements *corev1.ResourceRequirements) error {
+	computeResources := []corev1.ResourceName{corev1.ResourceCPU, corev1.ResourceMemory}
+
+	switch d.QoS {
+	case "":
+	case "guaranteed":
+		// Requests and limits must match, the limit wins when both are set
+		for _, name := range computeResources {
+			value, ok := requirements.Limits[name]
+			if !ok {
+				value, ok = requirements.Requests[name]
+			}
+			if !ok {
+				return fmt.Errorf("--qos guaranteed needs a %s request or limit", name)
+			}
+			requirements.Limits[name] = value.DeepCopy()
+			requirements.Requests[name] = value.DeepCopy()
+		}
+	case "burstable":
+		hasValue := false
+		for _, name := range computeResources {
+			_, hasRequest := requirements.Requests[name]
+			_, hasLimit := requirements.Limits[name]
+			hasValue = hasValue || hasRequest || hasLimit
+		}
+		if !hasValue {
+			return fmt.Errorf("--qos burstable needs a CPU or memory request or limit")
+		}
+		// Keep only the requests when they would make the container Guaranteed
+		if isGuaranteed(requirements) {
+			for _, name := range computeResources {
+				delete(requirements.Limits, name)
+			}
+		}
+	case "besteffort":
+		for _, name := range computeResources {
+			delete(requirements.Limits, name)
+			delete(requirements.Requests, name)
+		}
+	default:
+		return fmt.Errorf("invalid --qos %q: must be one of: %s", d.QoS, strings.Join(qosClasses, ", "))
+	}
+	return nil
+}
+
+// isGuaranteed reports whether CPU and memory limits are set and equal to the requests
+func isGuaranteed(requirements *corev1.ResourceRequirements) bool {
+	for _, name := range []corev1.ResourceName{corev1.ResourceCPU, corev1.ResourceMemory} {
+		limit, ok := requirements.Limits[name]
+		if !ok {
+			return false
+		}
+		if request, ok := requirements.Requests[name]; ok && request.Cmp(limit) != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// applyLimitRangeDefaults fills in the requests and limits the LimitRanger
+// admission plugin would set on the container
+func applyLimitRangeDefaults(container *corev1.Container, limitRanges []corev1.LimitRange) {
+	if container.Resources.Limits == nil {
+		container.Resources.Limits = corev1.ResourceList{}
+	}
+	if container.Resources.Requests == nil {
+		container.Resources.Requests = corev1.ResourceList{}
+	}
+
+	for _, lr := range limitRanges {
+		for _, item := range lr.Spec.Limits {
+			if item.Type != corev1.LimitTypeContainer {
+				continue
+			}
+			for name, value := range item.Default {
+				if _, ok := container.Resources.Limits[name]; !ok {
+					container.Resources.Limits[name] = value.DeepCopy()
+				}
+			}
+			for name, value := range item.DefaultRequest {
+				if _, ok := container.Resources.Requests[name]; !ok {
+					container.Resources.Requests[name] = value.DeepCopy()
+				}
+			}
+		}
+	}
+
+	// A limit without a request makes the request equal to the limit
+	for name, limit := range container.Resources.Limits {
+		if _, ok := container.Resources.Requests[name]; !ok {
+			container.Resources.Requests[name] = limit.DeepCopy()
+		}
+	}
+}
+
+// checkLimitRange verifies requests and limits against a single LimitRange item
+func checkLimitRange(what string, item corev1.LimitRangeItem, requests, limits corev1.ResourceList, lrName string) error {
+	for name, min := range item.Min {
+		if request, ok := requests[name]; !ok || request.Cmp(min) < 0 {
+			return fmt.Errorf("%s %s request %s is below the minimum %s of LimitRange %s", what, name, quantityString(requests, name), min.String(), lrName)
+		}
+	}
+	for name, max := range item.Max {
+		limit, ok := limits[name]
+		if !ok {
+			return fmt.Errorf("%s needs a %s limit to satisfy LimitRange %s (maximum %s)", what, name, lrName, max.String())
+		}
+		if limit.Cmp(max) > 0 {
+			return fmt.Errorf("%s %s limit %s exceeds the maximum %s of LimitRange %s", what, name, limit.String(), max.String(), lrName)
+		}
+	}
+	for name, ratio := range item.MaxLimitRequestRatio {
+		limit, hasLimit := limits[name]
+		request, hasRequest := requests[name]
+		if !hasLimit || !hasRequest || request.IsZero() {
+			continue
+		}
+		if float64(limit.MilliValue())/float64(request.MilliValue()) > ratio.AsApproximateFloat64() {
+			return fmt.Errorf("%s %s limit %s is more than %s times its request %s (LimitRange %s)", what, name, limit.String(), ratio.String(), request.String(), lrName)
+		}
+	}
+	return nil
+}
+
+func quantityString(list corev1.ResourceList, name corev1.ResourceName) string {
+	if q, ok := list[name]; ok {
+		return q.String()
+	}
+	return "<none>"
+}
+
+// podResources adds up the requests and limits of a pod the way quota does:
+// the sum of its containers or the largest init container, whichever is bigger.
+func podResources(pod *corev1.Pod) (requests, limits corev1.ResourceList) {
+	requests, limits = corev1.ResourceList{}, corev1.ResourceList{}
+	for _, c := range pod.Spec.Containers {
+		addResources(requests, c.Resources.Requests)
+		addResources(limits, c.Resources.Limits)
+	}
+	for _, c := range pod.Spec.InitContainers {
+		maxResources(requests, c.Resources.Requests)
+		maxResources(limits, c.Resources.Limits)
+	}
+	return requests, limits
+}
+
+func addResources(total, list corev1.ResourceList) {
+	for name, q := range list {
+		sum := total[name]
+		sum.Add(q)
+		total[name] = sum
+	}
+}
+
+func maxResources(total, list corev1.ResourceList) {
+	for name, q := range list {
+		if current, ok := total[name]; !ok || q.Cmp(current) > 0 {
+			total[name] = q.DeepCopy()
+		}
+	}
+}
+
+// quotaUsage returns what the pod adds to a quota for a hard resource name
+func quotaUsage(name corev1.ResourceName, requests, limits corev1.ResourceList) resource.Quantity {
+	switch name {
+	case corev1.ResourcePods, "count/pods":
+		return *resource.NewQuantity(1, resource.DecimalSI)
+	case corev1.ResourceCPU, corev1.ResourceRequestsCPU:
+		return requests[corev1.ResourceCPU]
+	case corev1.ResourceMemory, corev1.ResourceRequestsMemory:
+		return requests[corev1.ResourceMemory]
+	case corev1.ResourceEphemeralStorage, corev1.ResourceRequestsEphemeralStorage:
+		return requests[corev1.ResourceEphemeralStorage]
+	case corev1.ResourceLimitsCPU:
+		return limits[corev1.ResourceCPU]
+	case corev1.ResourceLimitsMemory:
+		return limits[corev1.ResourceMemory]
+	case corev1.ResourceLimitsEphemeralStorage:
+		return limits[corev1.ResourceEphemeralStorage]
+	}
+	return resource.Quantity{}
+}
+
+// quotaConstraint returns the resource a quota on name requires every
+// container to set, as a limit or a request
+func quotaConstraint(name corev1.ResourceName) (required corev1.ResourceName, limit bool, ok bool) {
+	switch name {
+	case corev1.ResourceCPU, corev1.ResourceRequestsCPU:
+		return corev1.ResourceCPU, false, true
+	case corev1.ResourceMemory, corev1.ResourceRequestsMemory:
+		return corev1.ResourceMemory, false, true
+	case corev1.ResourceLimitsCPU:
+		return corev1.ResourceCPU, true, true
+	case corev1.ResourceLimitsMemory:
+		return corev1.ResourceMemory, true, true
+	}
+	return "", false, false
+}
+
+// unconstrainedContainer returns the first init or regular container of pod
+// that does not set what a quota on name requires, "" when they all do
+func unconstrainedContainer(pod *corev1.Pod, name corev1.ResourceName) string {
+	required, limit, ok := quotaConstraint(name)
+	if !ok {
+		return ""
+	}
+	containers := append(append([]corev1.Container{}, pod.Spec.InitContainers...), pod.Spec.Containers...)
+	for _, c := range containers {
+		list := c.Resources.Requests
+		if limit {
+			list = c.Resources.Limits
+		}
+		if _, ok := list[required]; !ok {
+			return c.Name
+		}
+	}
+	return ""
+}
+
+// checkNamespaceResources makes sure the namespace's LimitRanges and
+// ResourceQuotas will admit pod once its debugger container is added
+func (d *Debugger) checkNamespaceResources(ctx context.Context, pod *corev1.Pod, debuggerName string) error {
+	client, err := d.getClient()
+	if err != nil {
+		return err
+	}
+
+	// Work on a copy, LimitRange defaults are filled in below
+	pod = pod.DeepCopy()
+	var debugger *corev1.Container
+	for i := range pod.Spec.Containers {
+		if pod.Spec.Containers[i].Name == debuggerName {
+			debugger = &pod.Spec.Containers[i]
+		}
+	}
+	if debugger == nil {
+		return fmt.Errorf("container %s not found in debug pod", debuggerName)
+	}
+
+	limitRanges, err := client.CoreV1().LimitRanges(d.Namespace).List(ctx, metav1.ListOptions{})
+	switch {
+	case apierrors.IsForbidden(err):
+		d.logf("Warning: Not allowed to read LimitRanges in namespace %s, skipping resource checks", d.Namespace)
+		limitRanges = &corev1.LimitRangeList{}
+	case err != nil:
+		return fmt.Errorf("error listing LimitRanges: %v", err)
+	}
+
+	// Admission fills in the defaults of every container, not only the
+	// debugger's, before the quota is charged
+	for i := range pod.Spec.InitContainers {
+		applyLimitRangeDefaults(&pod.Spec.InitContainers[i], limitRanges.Items)
+	}
+	for i := range pod.Spec.Containers {
+		applyLimitRangeDefaults(&pod.Spec.Containers[i], limitRanges.Items)
+	}
+	for _, lr := range limitRanges.Items {
+		for _, item := range lr.Spec.Limits {
+			switch item.Type {
+			case corev1.LimitTypeContainer:
+				err = checkLimitRange("debug container", item, debugger.Resources.Requests, debugger.Resources.Limits, lr.Name)
+			case corev1.LimitTypePod:
+				requests, limits := podResources(pod)
+				err = checkLimitRange("debug pod", item, requests, limits, lr.Name)
+			}
+			if err != nil {
+				return err
+			}
+		}
+	}
+	for name, request := range debugger.Resources.Requests {
+		if limit, ok := debugger.Resources.Limits[name]; ok && request.Cmp(limit) > 0 {
+			return fmt.Errorf("debug container %s request %s exceeds the default limit %s set by the namespace LimitRange", name, request.String(), limit.String())
+		}
+	}
+
+	quotas, err := client.CoreV1().ResourceQuotas(d.Namespace).List(ctx, metav1.ListOptions{})
+	switch {
+	case apierrors.IsForbidden(err):
+		d.logf("Warning: Not allowed to read ResourceQuotas in namespace %s, skipping quota checks", d.Namespace)
+		return nil
+	case err != nil:
+		return fmt.Errorf("error listing ResourceQuotas: %v", err)
+	}
+
+	requests, limits := podResources(pod)
+	for _, quota := range quotas.Items {
+		// Scoped quotas only apply to some pods, which is not worth guessing
+		if len(quota.Spec.Scopes) > 0 || quota.Spec.ScopeSelector != nil {
+			continue
+		}
+		for name, hard := range quota.Spec.Hard {
+			// Checked once LimitRange defaults are filled in, as admission does
+			if container := unconstrainedContainer(pod, name); container != "" {
+				return fmt.Errorf("ResourceQuota %s requires every container to set %s, container %s does not", quota.Name, name, container)
+			}
+			usage := quotaUsage(name, requests, limits)
+			if usage.IsZero() {
+				continue
+			}
+			total := quota.Status.Used[name]
+			total.Add(usage)
+			if total.Cmp(hard) > 0 {
+				used := quota.Status.Used[name]
+				return fmt.Errorf("debug pod would exceed ResourceQuota %s: %s used %s + requested %s > hard %s", quota.Name, name, used.String(), usage.String(), hard.String())
+			}
+		}
+	}
+	return nil
+}
+
+// Export functions for testing
+func (d *Debugger) DebugResources() (corev1.ResourceRequirements, error) {
+	return d.debugResources()
+}
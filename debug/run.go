@@ -0,0 +1,67 @@
+package debug
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+)
+
+// Command of debug containers that wait for commands run with exec
+var keepAliveCommand = []string{"sleep", "infinity"}
+
+// CommandExitError carries the exit code of a command run with --, which
+// kubectl-debug exits with
+type CommandExitError struct {
+	Code int
+}
+
+func (e *CommandExitError) Error() string {
+	return fmt.Sprintf("command exited with code %d", e.Code)
+}
+
+// isRunMode reports whether a command was given after --
+func (d *Debugger) isRunMode() bool {
+	return len(d.Command) > 0
+}
+
+// runCommandArgs returns the kubectl arguments running the command in container
+func (d *Debugger) runCommandArgs(pod, container string) []string {
+	args := []string{"exec", pod, "-n", d.Namespace, "-c", container}
+	if d.Interactive {
+		args = append(args, "-i")
+	}
+	if d.TTY {
+		args = append(args, "-t")
+	}
+	return append(append(args, "--"), d.Command...)
+}
+
+// runInContainer runs the command with exec, which keeps stdout and stderr
+// apart and exits with the remote exit code
+func (d *Debugger) runInContainer(ctx context.Context, pod, container string) error {
+	var stdin io.Reader
+	if d.Interactive {
+		stdin = os.Stdin
+	}
+	return d.execInContainer(ctx, pod, container, stdin, os.Stdout, os.Stderr)
+}
+
+// execInContainer runs the command in container with the given streams. A
+// non-zero exit of the command is returned as a CommandExitError.
+func (d *Debugger) execInContainer(ctx context.Context, pod, container string, stdin io.Reader, stdout, stderr io.Writer) error {
+	req := streamRequest{
+		pod:       pod,
+		container: container,
+		command:   d.Command,
+		stdin:     stdin,
+		stdout:    stdout,
+		stderr:    stderr,
+		tty:       d.TTY,
+	}
+	err := d.stream(ctx, req)
+	if _, ok := err.(*CommandExitError); err != nil && !ok {
+		return fmt.Errorf("error running command in %s: %v", pod, err)
+	}
+	return err
+}
@@ -0,0 +1,164 @@
+package debug
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"math/rand"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/duration"
+)
+
+// pickStrategies are the accepted values for --pick
+var pickStrategies = []string{"first", "random", "newest", "most-restarts"}
+
+func validatePickStrategy(strategy string) error {
+	if strategy == "" {
+		return nil
+	}
+	for _, valid := range pickStrategies {
+		if strategy == valid {
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid pick strategy %q: must be one of: %s", strategy, strings.Join(pickStrategies, ", "))
+}
+
+// pickPod chooses a pod without prompting using the given strategy
+func pickPod(pods []corev1.Pod, strategy string) (*corev1.Pod, error) {
+	if len(pods) == 0 {
+		return nil, fmt.Errorf("no pods to pick from")
+	}
+
+	switch strategy {
+	case "first":
+		return &pods[0], nil
+	case "random":
+		return &pods[rand.Intn(len(pods))], nil
+	case "newest":
+		newest := &pods[0]
+		for i := range pods {
+			if pods[i].CreationTimestamp.After(newest.CreationTimestamp.Time) {
+				newest = &pods[i]
+			}
+		}
+		return newest, nil
+	case "most-restarts":
+		most := &pods[0]
+		for i := range pods {
+			if podRestarts(&pods[i]) > podRestarts(most) {
+				most = &pods[i]
+			}
+		}
+		return most, nil
+	}
+	return nil, validatePickStrategy(strategy)
+}
+
+// podAge returns a human readable age such as 5m or 2d
+func podAge(pod *corev1.Pod) string {
+	if pod.CreationTimestamp.IsZero() {
+		return "<unknown>"
+	}
+	return duration.HumanDuration(time.Since(pod.CreationTimestamp.Time))
+}
+
+func (d *Debugger) askForPod(pods []corev1.Pod) (*corev1.Pod, error) {
+	fmt.Printf("%d pods match selector '%s' in namespace '%s':\n", len(pods), d.Selector, d.Namespace)
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "\tNAME\tPHASE\tRESTARTS\tNODE\tAGE")
+	for i := range pods {
+		pod := &pods[i]
+		fmt.Fprintf(w, "[%d]\t%s\t%s\t%d\t%s\t%s\n", i+1, pod.Name, pod.Status.Phase, podRestarts(pod), pod.Spec.NodeName, podAge(pod))
+	}
+	w.Flush()
+	fmt.Printf("Choose (1-%d) [1]: ", len(pods))
+
+	reader := bufio.NewReader(os.Stdin)
+	response, err := reader.ReadString('\n')
+	if err != nil {
+		return nil, fmt.Errorf("error reading selection: %v", err)
+	}
+
+	response = strings.TrimSpace(response)
+	if response == "" {
+		return &pods[0], nil
+	}
+	choice, err := strconv.Atoi(response)
+	if err != nil || choice < 1 || choice > len(pods) {
+		return nil, fmt.Errorf("invalid selection %q", response)
+	}
+	return &pods[choice-1], nil
+}
+
+// selectorPods returns the pods matching --selector sorted by name,
+// leaving out debug pods
+func (d *Debugger) selectorPods(ctx context.Context) ([]corev1.Pod, error) {
+	client, err := d.getClient()
+	if err != nil {
+		return nil, err
+	}
+
+	list, err := client.CoreV1().Pods(d.Namespace).List(ctx, metav1.ListOptions{LabelSelector: d.Selector})
+	if err != nil {
+		return nil, fmt.Errorf("error listing pods with selector %s: %v", d.Selector, err)
+	}
+
+	var pods []corev1.Pod
+	for _, pod := range list.Items {
+		// Never pick one of our own debug pods
+		if pod.Labels["debug-tool/type"] == "debug-pod" {
+			continue
+		}
+		pods = append(pods, pod)
+	}
+	if len(pods) == 0 {
+		return nil, fmt.Errorf("no pods match selector %s in namespace %s", d.Selector, d.Namespace)
+	}
+	sort.Slice(pods, func(i, j int) bool { return pods[i].Name < pods[j].Name })
+	return pods, nil
+}
+
+// selectTargetPod sets podName to a pod matching --selector, prompting when
+// several pods match and no --pick strategy is given.
+func (d *Debugger) selectTargetPod(ctx context.Context) error {
+	pods, err := d.selectorPods(ctx)
+	if err != nil {
+		return err
+	}
+
+	var pod *corev1.Pod
+	switch {
+	case len(pods) == 1:
+		pod = &pods[0]
+	case d.Pick != "":
+		pod, err = pickPod(pods, d.Pick)
+	default:
+		pod, err = d.askForPod(pods)
+	}
+	if err != nil {
+		return err
+	}
+
+	d.Pod = pod.Name
+	return nil
+}
+
+// Export functions for testing
+func PickPod(pods []corev1.Pod, strategy string) (*corev1.Pod, error) {
+	return pickPod(pods, strategy)
+}
+
+func (d *Debugger) SelectTargetPod() (string, error) {
+	err := d.selectTargetPod(context.Background())
+	return d.Pod, err
+}
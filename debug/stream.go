@@ -0,0 +1,186 @@
+package debug
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"time"
+
+	"golang.org/x/term"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/httpstream"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/remotecommand"
+	utilexec "k8s.io/client-go/util/exec"
+)
+
+// streamRequest describes an exec or attach session in a container
+type streamRequest struct {
+	pod       string
+	container string
+	// command is run with exec, a nil command attaches to the container
+	command []string
+	stdin   io.Reader
+	stdout  io.Writer
+	stderr  io.Writer
+	tty     bool
+}
+
+// stream runs an exec or attach session through the pods/exec or
+// pods/attach subresource. A non-zero exit of the session is returned as a
+// CommandExitError.
+func (d *Debugger) stream(ctx context.Context, req streamRequest) error {
+	config, err := d.clientConfig().ClientConfig()
+	if err != nil {
+		return fmt.Errorf("error loading kubeconfig: %v", err)
+	}
+	client, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return fmt.Errorf("error creating kubernetes client: %v", err)
+	}
+
+	request := client.CoreV1().RESTClient().Post().
+		Resource("pods").
+		Namespace(d.Namespace).
+		Name(req.pod)
+	if req.command == nil {
+		request = request.SubResource("attach").VersionedParams(&corev1.PodAttachOptions{
+			Container: req.container,
+			Stdin:     req.stdin != nil,
+			Stdout:    true,
+			Stderr:    !req.tty,
+			TTY:       req.tty,
+		}, scheme.ParameterCodec)
+	} else {
+		request = request.SubResource("exec").VersionedParams(&corev1.PodExecOptions{
+			Container: req.container,
+			Command:   req.command,
+			Stdin:     req.stdin != nil,
+			Stdout:    true,
+			Stderr:    !req.tty,
+			TTY:       req.tty,
+		}, scheme.ParameterCodec)
+	}
+	sessions := d.sessions
+	if sessions == nil {
+		sessions = apiExecutor{}
+	}
+	executor, err := sessions.executor(config, request.URL())
+	if err != nil {
+		return err
+	}
+
+	options := remotecommand.StreamOptions{
+		Stdin:  req.stdin,
+		Stdout: req.stdout,
+		Tty:    req.tty,
+	}
+	// A terminal merges stderr into stdout
+	if !req.tty {
+		options.Stderr = req.stderr
+	}
+
+	streamCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	if req.tty {
+		if restore := rawTerminal(req.stdin); restore != nil {
+			defer restore()
+		}
+		if out, ok := req.stdout.(*os.File); ok && term.IsTerminal(int(out.Fd())) {
+			options.TerminalSizeQueue = &terminalSizes{ctx: streamCtx, fd: int(out.Fd())}
+		}
+	}
+
+	err = executor.StreamWithContext(streamCtx, options)
+	var exitErr utilexec.ExitError
+	if errors.As(err, &exitErr) && exitErr.Exited() {
+		return &CommandExitError{Code: exitErr.ExitStatus()}
+	}
+	return err
+}
+
+// sessionExecutor creates the executor streaming the exec or attach session
+// at sessionURL
+type sessionExecutor interface {
+	executor(config *rest.Config, sessionURL *url.URL) (remotecommand.Executor, error)
+}
+
+// executorFunc turns a function into a sessionExecutor
+type executorFunc func(config *rest.Config, sessionURL *url.URL) (remotecommand.Executor, error)
+
+func (f executorFunc) executor(config *rest.Config, sessionURL *url.URL) (remotecommand.Executor, error) {
+	return f(config, sessionURL)
+}
+
+// apiExecutor streams sessions over WebSocket, with a fallback to SPDY for
+// older API servers like kubectl
+type apiExecutor struct{}
+
+func (apiExecutor) executor(config *rest.Config, sessionURL *url.URL) (remotecommand.Executor, error) {
+	spdy, err := remotecommand.NewSPDYExecutor(config, "POST", sessionURL)
+	if err != nil {
+		return nil, fmt.Errorf("error creating SPDY executor: %v", err)
+	}
+	websocket, err := remotecommand.NewWebSocketExecutor(config, "GET", sessionURL.String())
+	if err != nil {
+		return nil, fmt.Errorf("error creating WebSocket executor: %v", err)
+	}
+	return remotecommand.NewFallbackExecutor(websocket, spdy, func(err error) bool {
+		return httpstream.IsUpgradeFailure(err) || httpstream.IsHTTPSProxyError(err)
+	})
+}
+
+// rawTerminal puts the terminal of stdin in raw mode so keys reach the
+// session as typed. It returns the function restoring it, nil when stdin is
+// not a terminal.
+func rawTerminal(stdin io.Reader) func() {
+	in, ok := stdin.(*os.File)
+	if !ok || !term.IsTerminal(int(in.Fd())) {
+		return nil
+	}
+	fd := int(in.Fd())
+	state, err := term.MakeRaw(fd)
+	if err != nil {
+		return nil
+	}
+	return func() { term.Restore(fd, state) }
+}
+
+// terminalSizes reports the size of the terminal when the session starts and
+// whenever it changes, polled as resize signals are not portable
+type terminalSizes struct {
+	ctx  context.Context
+	fd   int
+	last remotecommand.TerminalSize
+}
+
+func (t *terminalSizes) Next() *remotecommand.TerminalSize {
+	for {
+		if width, height, err := term.GetSize(t.fd); err == nil {
+			size := remotecommand.TerminalSize{Width: uint16(width), Height: uint16(height)}
+			if size != t.last {
+				t.last = size
+				return &size
+			}
+		}
+		select {
+		case <-t.ctx.Done():
+			return nil
+		case <-time.After(250 * time.Millisecond):
+		}
+	}
+}
+
+// Export functions for testing
+func (d *Debugger) SetSessionExecutor(f func(config *rest.Config, sessionURL *url.URL) (remotecommand.Executor, error)) {
+	if f == nil {
+		d.sessions = nil
+		return
+	}
+	d.sessions = executorFunc(f)
+}
@@ -0,0 +1,192 @@
+package debug
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Toolkit is a named set of debug tools: the images that ship them, the
+// profile they need and the command of interactive sessions
+type Toolkit struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	// Source is where the toolkit was defined
+	Source string `json:"source,omitempty"`
+	// Images are variants of the same tools, the one whose
+	// container.run.as.root label suits the profile is used
+	Images []string `json:"images"`
+	// Profile is used unless a profile is selected
+	Profile string `json:"profile,omitempty"`
+	// Command is run by interactive sessions instead of the image's default
+	Command []string `json:"command,omitempty"`
+}
+
+// builtinToolkits are built from the Dockerfile, each in a nonroot and a
+// root variant
+var builtinToolkits = []Toolkit{
+	{
+		Name:        "net",
+		Description: "DNS, connectivity and packet capture: dig, curl, nmap, mtr, netcat, iperf, tcpdump",
+		Images:      []string{"jbuet/debug:net", "jbuet/debug:net-root"},
+		Command:     []string{"bash"},
+	},
+	{
+		Name:        "proc",
+		Description: "Processes and I/O: htop, strace, ltrace, lsof, sysstat, psmisc",
+		Images:      []string{"jbuet/debug:proc", "jbuet/debug:proc-root"},
+		Command:     []string{"bash"},
+	},
+	{
+		Name:        "jvm",
+		Description: "JDK diagnostics: jcmd, jstack, jmap, jfr",
+		Images:      []string{"jbuet/debug:jvm", "jbuet/debug:jvm-root"},
+		Command:     []string{"bash"},
+	},
+	{
+		Name:        "python",
+		Description: "Python 3 with py-spy",
+		Images:      []string{"jbuet/debug:python", "jbuet/debug:python-root"},
+		Command:     []string{"bash"},
+	},
+	{
+		Name:        "go",
+		Description: "Go toolchain with delve",
+		Images:      []string{"jbuet/debug:go", "jbuet/debug:go-root"},
+		Command:     []string{"bash"},
+	},
+	{
+		Name:        "db",
+		Description: "Database clients: psql, mysql, redis-cli, sqlite3",
+		Images:      []string{"jbuet/debug:db", "jbuet/debug:db-root"},
+		Profile:     "restricted",
+		Command:     []string{"bash"},
+	},
+}
+
+// ToolkitCatalog returns the built-in toolkits and DebugOptions.Toolkits, which
+// replace built-in toolkits of the same name, sorted by name
+func (d *Debugger) ToolkitCatalog() []Toolkit {
+	byName := map[string]Toolkit{}
+	for _, tk := range builtinToolkits {
+		tk.Source = "built-in"
+		byName[tk.Name] = tk
+	}
+	for name, tk := range d.Toolkits {
+		tk.Name = name
+		if tk.Source == "" {
+			tk.Source = "options"
+		}
+		byName[name] = tk
+	}
+
+	toolkits := make([]Toolkit, 0, len(byName))
+	for _, tk := range byName {
+		toolkits = append(toolkits, tk)
+	}
+	sort.Slice(toolkits, func(i, j int) bool { return toolkits[i].Name < toolkits[j].Name })
+	return toolkits
+}
+
+func (d *Debugger) lookupToolkit(name string) (Toolkit, error) {
+	var names []string
+	for _, tk := range d.ToolkitCatalog() {
+		if tk.Name == name {
+			if len(tk.Images) == 0 {
+				return Toolkit{}, fmt.Errorf("toolkit %q has no images", name)
+			}
+			return tk, nil
+		}
+		names = append(names, tk.Name)
+	}
+	return Toolkit{}, fmt.Errorf("invalid toolkit %q: must be one of: %s", name, strings.Join(names, ", "))
+}
+
+// profileRunsAsRoot reports whether the selected profile lets the debug
+// container run as root
+func (d *Debugger) profileRunsAsRoot() bool {
+	sc, _ := d.SecurityContexts(d.Profile)
+	if sc.RunAsNonRoot != nil && *sc.RunAsNonRoot {
+		return false
+	}
+	return sc.RunAsUser == nil || *sc.RunAsUser == 0
+}
+
+// resolveToolkit sets the image, the profile and the session command from
+// the selected toolkit. The labels of its images are only read from their
+// registry with readLabels, the variant is otherwise told by its name.
+func (d *Debugger) resolveToolkit(ctx context.Context, readLabels bool) error {
+	if d.Toolkit == "" {
+		d.toolkit = nil
+		return nil
+	}
+	tk, err := d.lookupToolkit(d.Toolkit)
+	if err != nil {
+		return err
+	}
+	if d.Profile == "" {
+		d.Profile = tk.Profile
+	}
+	d.Image = d.toolkitImage(ctx, tk, readLabels)
+	d.toolkit = &tk
+	return nil
+}
+
+// toolkitImage picks the variant of the toolkit's images whose
+// container.run.as.root label matches the profile. When a label cannot be
+// read, the variant is assumed from the image names.
+func (d *Debugger) toolkitImage(ctx context.Context, tk Toolkit, readLabels bool) string {
+	if len(tk.Images) == 1 {
+		return tk.Images[0]
+	}
+
+	wantRoot := d.profileRunsAsRoot()
+	variant := "nonroot"
+	if wantRoot {
+		variant = "root"
+	}
+	if readLabels {
+		unreadable := false
+		for _, image := range tk.Images {
+			root, err := imageRunsAsRoot(ctx, image)
+			if err != nil {
+				d.logf("Warning: Could not read the %s label of %s: %v", labelRunAsRoot, image, err)
+				unreadable = true
+				continue
+			}
+			if root == wantRoot {
+				return image
+			}
+		}
+		if !unreadable {
+			d.logf("Warning: No %s image found for toolkit %s, using %s", variant, tk.Name, tk.Images[0])
+			return tk.Images[0]
+		}
+	}
+
+	for _, image := range tk.Images {
+		if variantRunsAsRoot(image) == wantRoot {
+			d.logf("Assuming %s is the %s variant of toolkit %s", image, variant, tk.Name)
+			return image
+		}
+	}
+	d.logf("Warning: No %s image found for toolkit %s, using %s", variant, tk.Name, tk.Images[0])
+	return tk.Images[0]
+}
+
+// variantRunsAsRoot tells the variant of an image from its name, root
+// variants end in root like jbuet/debug:net-root
+func variantRunsAsRoot(image string) bool {
+	name := strings.SplitN(image, "@", 2)[0]
+	return strings.HasSuffix(name, "root") && !strings.HasSuffix(name, "nonroot")
+}
+
+// sessionCommand is the command of interactive debug containers, nil for
+// the image's default
+func (d *Debugger) sessionCommand() []string {
+	if d.toolkit != nil {
+		return d.toolkit.Command
+	}
+	return nil
+}
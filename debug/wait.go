@@ -0,0 +1,365 @@
+package debug
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+// Waiting reasons after which a container will not start without intervention
+var (
+	imagePullFailures = map[string]bool{
+		"ErrImagePull":      true,
+		"ImagePullBackOff":  true,
+		"InvalidImageName":  true,
+		"ErrImageNeverPull": true,
+	}
+	containerStartFailures = map[string]bool{
+		"CreateContainerConfigError": true,
+		"CreateContainerError":       true,
+		"RunContainerError":          true,
+		"CrashLoopBackOff":           true,
+	}
+)
+
+// podDiagnostics collects what the events of a pod tell about it
+type podDiagnostics struct {
+	lastWarning string
+	pullErrors  []string
+	scaleUp     bool
+}
+
+// observe records an event of the pod being waited for
+func (d *podDiagnostics) observe(event *corev1.Event, name string) {
+	if event.InvolvedObject.Kind != "Pod" || event.InvolvedObject.Name != name {
+		return
+	}
+	switch {
+	case event.Reason == "TriggeredScaleUp":
+		// The cluster autoscaler is adding a node, scheduling may still succeed
+		d.scaleUp = true
+	case event.Type == corev1.EventTypeWarning:
+		d.lastWarning = fmt.Sprintf("%s: %s", event.Reason, event.Message)
+		if event.Reason == "Failed" && strings.Contains(event.Message, "pull") {
+			d.pullErrors = append(d.pullErrors, event.Message)
+		}
+	}
+}
+
+// pullError returns the most recent pull failure reported for image
+func (d *podDiagnostics) pullError(image string) string {
+	for i := len(d.pullErrors) - 1; i >= 0; i-- {
+		if strings.Contains(d.pullErrors[i], image) {
+			return d.pullErrors[i]
+		}
+	}
+	return ""
+}
+
+// containerFailure explains why a container will not start, or returns nil
+// while it still may
+func (d *podDiagnostics) containerFailure(status *corev1.ContainerStatus) error {
+	if terminated := status.State.Terminated; terminated != nil {
+		return fmt.Errorf("container %s terminated: %s", status.Name, firstNonEmpty(terminated.Message, terminated.Reason, fmt.Sprintf("exit code %d", terminated.ExitCode)))
+	}
+
+	waiting := status.State.Waiting
+	if waiting == nil {
+		return nil
+	}
+	switch {
+	case imagePullFailures[waiting.Reason]:
+		detail := firstNonEmpty(d.pullError(status.Image), waiting.Message, waiting.Reason)
+		return fmt.Errorf("image %s could not be pulled: %s", status.Image, detail)
+	case containerStartFailures[waiting.Reason]:
+		return fmt.Errorf("container %s cannot start: %s", status.Name, firstNonEmpty(waiting.Message, waiting.Reason))
+	}
+	return nil
+}
+
+// podFailure explains why a pod will not become ready, or returns nil while
+// it still may
+func (d *podDiagnostics) podFailure(pod *corev1.Pod) error {
+	switch pod.Status.Phase {
+	case corev1.PodFailed, corev1.PodSucceeded:
+		return fmt.Errorf("pod %s stopped: %s", pod.Name, firstNonEmpty(pod.Status.Message, pod.Status.Reason, string(pod.Status.Phase)))
+	}
+
+	for _, cond := range pod.Status.Conditions {
+		if cond.Type == corev1.PodScheduled && cond.Status == corev1.ConditionFalse &&
+			cond.Reason == corev1.PodReasonUnschedulable && !d.scaleUp {
+			return fmt.Errorf("pod %s cannot be scheduled: %s", pod.Name, cond.Message)
+		}
+	}
+
+	statuses := append(append([]corev1.ContainerStatus{}, pod.Status.InitContainerStatuses...), pod.Status.ContainerStatuses...)
+	for i := range statuses {
+		if statuses[i].State.Terminated != nil && statuses[i].State.Terminated.ExitCode == 0 {
+			continue // a finished init container
+		}
+		if err := d.containerFailure(&statuses[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// timeoutError describes what the pod was still waiting for at the timeout
+func (d *podDiagnostics) timeoutError(what string, timeout time.Duration, pod *corev1.Pod) error {
+	reason := d.lastWarning
+	if reason == "" && pod != nil {
+		statuses := append(append([]corev1.ContainerStatus{}, pod.Status.ContainerStatuses...), pod.Status.EphemeralContainerStatuses...)
+		for _, status := range statuses {
+			if status.State.Waiting != nil {
+				reason = fmt.Sprintf("container %s is waiting: %s", status.Name, firstNonEmpty(status.State.Waiting.Message, status.State.Waiting.Reason))
+				break
+			}
+		}
+	}
+	if reason == "" && pod != nil {
+		reason = "pod is " + string(pod.Status.Phase)
+	}
+	return fmt.Errorf("%s was not ready after %s: %s", what, timeout, reason)
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// podCheck tells whether the wait for a pod is over, or why it never will be
+type podCheck func(pod *corev1.Pod, diag *podDiagnostics) (bool, error)
+
+func eventListOptions(name string) metav1.ListOptions {
+	return metav1.ListOptions{
+		FieldSelector: fields.Set{"involvedObject.kind": "Pod", "involvedObject.name": name}.String(),
+	}
+}
+
+// waitForPodState watches pod name and its events until check is satisfied,
+// fails, or --timeout runs out. what names the thing waited for in errors.
+func (d *Debugger) waitForPodState(ctx context.Context, name, what string, check podCheck) error {
+	client, err := d.getClient()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, d.WaitTimeout)
+	defer cancel()
+
+	diag := &podDiagnostics{}
+	eventOptions := eventListOptions(name)
+	if events, err := client.CoreV1().Events(d.Namespace).List(ctx, eventOptions); err == nil {
+		for i := range events.Items {
+			diag.observe(&events.Items[i], name)
+		}
+		eventOptions.ResourceVersion = events.ResourceVersion
+	}
+
+	pod, err := client.CoreV1().Pods(d.Namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("error getting pod %s: %v", name, err)
+	}
+	if done, err := check(pod, diag); done || err != nil {
+		return err
+	}
+
+	podOptions := metav1.ListOptions{
+		FieldSelector:   fields.OneTermEqualSelector("metadata.name", name).String(),
+		ResourceVersion: pod.ResourceVersion,
+	}
+	podWatch, err := client.CoreV1().Pods(d.Namespace).Watch(ctx, podOptions)
+	if err != nil {
+		return fmt.Errorf("error watching pod %s: %v", name, err)
+	}
+	defer func() {
+		if podWatch != nil {
+			podWatch.Stop()
+		}
+	}()
+
+	// resume restarts the pod watch where it stopped. A version the server
+	// no longer keeps expires the watch, the pod is then read again and
+	// watched from its current version.
+	resume := func(expired bool) (bool, error) {
+		podWatch.Stop()
+		for {
+			if expired {
+				latest, err := client.CoreV1().Pods(d.Namespace).Get(ctx, name, metav1.GetOptions{})
+				if err != nil {
+					return false, fmt.Errorf("error getting pod %s: %v", name, err)
+				}
+				pod = latest
+				if done, err := check(pod, diag); done || err != nil {
+					return true, err
+				}
+			}
+			podOptions.ResourceVersion = pod.ResourceVersion
+			var err error
+			if podWatch, err = client.CoreV1().Pods(d.Namespace).Watch(ctx, podOptions); err == nil {
+				return false, nil
+			}
+			if expired || !isWatchExpired(err) {
+				return false, fmt.Errorf("error watching pod %s: %v", name, err)
+			}
+			expired = true
+		}
+	}
+
+	// Events only add detail, waiting works without them
+	var eventChan <-chan watch.Event
+	if eventWatch, err := client.CoreV1().Events(d.Namespace).Watch(ctx, eventOptions); err == nil {
+		defer eventWatch.Stop()
+		eventChan = eventWatch.ResultChan()
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			if ctx.Err() == context.DeadlineExceeded {
+				return diag.timeoutError(what, d.WaitTimeout, pod)
+			}
+			return ctx.Err()
+
+		case event, ok := <-podWatch.ResultChan():
+			// The server closes watches after a while, and expires them when
+			// they fall too far behind
+			expired := false
+			if ok && event.Type == watch.Error {
+				err := apierrors.FromObject(event.Object)
+				if !isWatchExpired(err) {
+					return fmt.Errorf("error watching pod %s: %v", name, err)
+				}
+				expired = true
+			}
+			if !ok || expired {
+				if done, err := resume(expired); done || err != nil {
+					if err != nil && ctx.Err() == context.DeadlineExceeded {
+						return diag.timeoutError(what, d.WaitTimeout, pod)
+					}
+					return err
+				}
+				continue
+			}
+			if event.Type == watch.Deleted {
+				return fmt.Errorf("pod %s was deleted", name)
+			}
+			updated, ok := event.Object.(*corev1.Pod)
+			if !ok || updated.Name != name {
+				continue
+			}
+			pod = updated
+			if done, err := check(pod, diag); done || err != nil {
+				return err
+			}
+
+		case event, ok := <-eventChan:
+			if !ok {
+				eventChan = nil
+				continue
+			}
+			if e, ok := event.Object.(*corev1.Event); ok {
+				diag.observe(e, name)
+				// A new event may explain the current pod status better
+				if done, err := check(pod, diag); done || err != nil {
+					return err
+				}
+			}
+		}
+	}
+}
+
+// isWatchExpired reports whether a watch failed because the version it
+// started from is no longer kept by the server
+func isWatchExpired(err error) bool {
+	return apierrors.IsResourceExpired(err) || apierrors.IsGone(err)
+}
+
+// isPodRunning reports whether every container of the pod is running
+func isPodRunning(pod *corev1.Pod) bool {
+	if pod.Status.Phase != corev1.PodRunning || len(pod.Status.ContainerStatuses) < len(pod.Spec.Containers) {
+		return false
+	}
+	for _, status := range pod.Status.ContainerStatuses {
+		if status.State.Running == nil {
+			return false
+		}
+	}
+	return true
+}
+
+// waitForPod waits until all containers of the debug pod are running
+func (d *Debugger) waitForPod(ctx context.Context, debugPodName string) error {
+	return d.waitForPodState(ctx, debugPodName, "pod "+debugPodName, func(pod *corev1.Pod, diag *podDiagnostics) (bool, error) {
+		if err := diag.podFailure(pod); err != nil {
+			return false, err
+		}
+		return isPodRunning(pod), nil
+	})
+}
+
+// waitForContainer waits until one container of a pod is running. The other
+// containers of a pod copy may fail, as the target does.
+func (d *Debugger) waitForContainer(ctx context.Context, podName, name string) error {
+	return d.waitForPodState(ctx, podName, "container "+name, func(pod *corev1.Pod, diag *podDiagnostics) (bool, error) {
+		if pod.Status.Phase == corev1.PodFailed || pod.Status.Phase == corev1.PodSucceeded {
+			return false, diag.podFailure(pod)
+		}
+		for i := range pod.Status.ContainerStatuses {
+			status := &pod.Status.ContainerStatuses[i]
+			if status.Name != name {
+				continue
+			}
+			if status.State.Running != nil {
+				return true, nil
+			}
+			return false, diag.containerFailure(status)
+		}
+		return false, nil
+	})
+}
+
+// waitForEphemeralContainer waits until the ephemeral container is running.
+// The rest of the target pod may be unhealthy, that is why it is debugged.
+func (d *Debugger) waitForEphemeralContainer(ctx context.Context, podName, name string) error {
+	return d.waitForPodState(ctx, podName, "container "+name, func(pod *corev1.Pod, diag *podDiagnostics) (bool, error) {
+		for i := range pod.Status.EphemeralContainerStatuses {
+			status := &pod.Status.EphemeralContainerStatuses[i]
+			if status.Name != name {
+				continue
+			}
+			if status.State.Running != nil {
+				return true, nil
+			}
+			return false, diag.containerFailure(status)
+		}
+		return false, nil
+	})
+}
+
+// explainAdmissionError turns admission rejections of what (e.g. "debug pod")
+// into a short explanation
+func explainAdmissionError(what string, err error) error {
+	msg := err.Error()
+	if i := strings.Index(msg, "violates PodSecurity "); i >= 0 {
+		return fmt.Errorf("%s %s; choose a stricter --profile", what, msg[i:])
+	}
+	if i := strings.Index(msg, "admission webhook "); i >= 0 {
+		return fmt.Errorf("%s rejected by %s", what, msg[i:])
+	}
+	if apierrors.IsForbidden(err) {
+		return fmt.Errorf("%s not allowed: %v", what, err)
+	}
+	return err
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"os"
 
@@ -9,6 +10,11 @@ import (
 
 func main() {
 	if err := cmd.Execute(); err != nil {
+		// A command run with -- failed, exit like it did
+		var exitErr *cmd.CommandExitError
+		if errors.As(err, &exitErr) {
+			os.Exit(exitErr.Code)
+		}
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 		os.Exit(1)
 	}
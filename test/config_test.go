@@ -0,0 +1,172 @@
+package test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jbuet/kubectl-debug/cmd"
+)
+
+const testConfig = `defaults:
+  image: registry.example.com/debug:1
+  memory-limit: 256Mi
+namespaces:
+  payments:
+    profile: restricted
+contexts:
+  prod:
+    defaults:
+      image: registry.prod.example.com/debug:1
+    namespaces:
+      payments:
+        profile: baseline
+`
+
+func writeConfigFile(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if content != "" {
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Setenv("KUBECTL_DEBUG_CONFIG", path)
+	return path
+}
+
+func TestApplyConfig(t *testing.T) {
+	defer cmd.SetImage("jbuet/debug:latest")
+	defer cmd.SetProfile("")
+	defer cmd.SetResources("100m", "128Mi", "128Mi")
+	defer cmd.SetKubeContext("")
+	defer cmd.SetNamespace("")
+
+	tests := []struct {
+		name        string
+		kubeContext string
+		namespace   string
+		env         map[string]string
+		wantImage   string
+		wantProfile string
+		wantMemory  string
+	}{
+		{name: "Global", kubeContext: "dev", namespace: "default",
+			wantImage: "registry.example.com/debug:1", wantMemory: "256Mi"},
+		{name: "Namespace", kubeContext: "dev", namespace: "payments",
+			wantImage: "registry.example.com/debug:1", wantProfile: "restricted", wantMemory: "256Mi"},
+		{name: "Context", kubeContext: "prod", namespace: "default",
+			wantImage: "registry.prod.example.com/debug:1", wantMemory: "256Mi"},
+		{name: "Context namespace", kubeContext: "prod", namespace: "payments",
+			wantImage: "registry.prod.example.com/debug:1", wantProfile: "baseline", wantMemory: "256Mi"},
+		{name: "Environment", kubeContext: "prod", namespace: "payments",
+			env:       map[string]string{"KUBECTL_DEBUG_PROFILE": "general", "KUBECTL_DEBUG_MEMORY_LIMIT": "512Mi"},
+			wantImage: "registry.prod.example.com/debug:1", wantProfile: "general", wantMemory: "512Mi"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			writeConfigFile(t, testConfig)
+			for name, value := range tt.env {
+				t.Setenv(name, value)
+			}
+			cmd.SetImage("jbuet/debug:latest")
+			cmd.SetProfile("")
+			cmd.SetResources("100m", "128Mi", "128Mi")
+			cmd.SetKubeContext(tt.kubeContext)
+			cmd.SetNamespace(tt.namespace)
+
+			if err := cmd.ApplyConfig(); err != nil {
+				t.Fatalf("ApplyConfig() error = %v", err)
+			}
+
+			if got := cmd.GetImage(); got != tt.wantImage {
+				t.Errorf("image = %q, want %q", got, tt.wantImage)
+			}
+			if got := cmd.GetProfile(); got != tt.wantProfile {
+				t.Errorf("profile = %q, want %q", got, tt.wantProfile)
+			}
+			resources, err := cmd.DebugResources()
+			if err != nil {
+				t.Fatalf("DebugResources() error = %v", err)
+			}
+			if got := resources.Limits.Memory().String(); got != tt.wantMemory {
+				t.Errorf("memory limit = %s, want %s", got, tt.wantMemory)
+			}
+		})
+	}
+}
+
+func TestApplyConfigErrors(t *testing.T) {
+	defer cmd.SetKubeContext("")
+	defer cmd.SetTTL(0)
+	cmd.SetKubeContext("dev")
+
+	tests := []struct {
+		name    string
+		config  string
+		env     map[string]string
+		wantErr string
+	}{
+		{name: "Unknown key", config: "defaults:\n  colour: red\n", wantErr: `unknown key "colour"`},
+		{name: "Unknown field", config: "default:\n  image: debug\n", wantErr: "error parsing config file"},
+		{name: "Invalid value", config: "contexts:\n  dev:\n    defaults:\n      ttl: soon\n", wantErr: "config file, context dev"},
+		{name: "Invalid environment", env: map[string]string{"KUBECTL_DEBUG_TTL": "soon"}, wantErr: "KUBECTL_DEBUG_TTL"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			writeConfigFile(t, tt.config)
+			for name, value := range tt.env {
+				t.Setenv(name, value)
+			}
+
+			err := cmd.ApplyConfig()
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("ApplyConfig() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSetAndUnsetConfig(t *testing.T) {
+	defer cmd.SetKubeContext("")
+	defer cmd.SetNamespace("")
+	path := writeConfigFile(t, "")
+
+	cmd.SetKubeContext("prod")
+	cmd.SetNamespace("payments")
+	if _, err := captureStdout(t, func() error { return cmd.SetConfig("profile", "restricted") }); err != nil {
+		t.Fatalf("SetConfig() error = %v", err)
+	}
+	cmd.SetKubeContext("")
+	cmd.SetNamespace("")
+	if _, err := captureStdout(t, func() error { return cmd.SetConfig("ttl", "2h") }); err != nil {
+		t.Fatalf("SetConfig() error = %v", err)
+	}
+
+	data, _ := os.ReadFile(path)
+	want := "contexts:\n  prod:\n    namespaces:\n      payments:\n        profile: restricted\ndefaults:\n  ttl: 2h\n"
+	if string(data) != want {
+		t.Errorf("config file =\n%s\nwant\n%s", data, want)
+	}
+
+	if err := cmd.SetConfig("ttl", "soon"); err == nil || !strings.Contains(err.Error(), "invalid ttl") {
+		t.Errorf("SetConfig() error = %v, want an invalid ttl", err)
+	}
+	if err := cmd.SetConfig("colour", "red"); err == nil || !strings.Contains(err.Error(), "unknown key") {
+		t.Errorf("SetConfig() error = %v, want an unknown key", err)
+	}
+
+	// Unsetting the last value of a scope removes the scope
+	cmd.SetKubeContext("prod")
+	cmd.SetNamespace("payments")
+	if _, err := captureStdout(t, func() error { return cmd.UnsetConfig("profile") }); err != nil {
+		t.Fatalf("UnsetConfig() error = %v", err)
+	}
+	data, _ = os.ReadFile(path)
+	if string(data) != "defaults:\n  ttl: 2h\n" {
+		t.Errorf("config file after unset =\n%s", data)
+	}
+}
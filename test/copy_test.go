@@ -0,0 +1,192 @@
+package test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jbuet/kubectl-debug/cmd"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// newProbedPod returns a running pod with an app and a sidecar container,
+// both with liveness, readiness and startup probes
+func newProbedPod(name, namespace string) *corev1.Pod {
+	probe := &corev1.Probe{
+		ProbeHandler: corev1.ProbeHandler{HTTPGet: &corev1.HTTPGetAction{Path: "/healthz"}},
+	}
+	pod := newTargetPod(name, namespace)
+	pod.Spec.NodeName = "node-1"
+	pod.Spec.Containers = []corev1.Container{
+		{Name: "app", Image: "myapp:1.0", Command: []string{"/app"}, Args: []string{"--port=8080"}},
+		{Name: "sidecar", Image: "envoy:1.30"},
+	}
+	for i := range pod.Spec.Containers {
+		pod.Spec.Containers[i].LivenessProbe = probe
+		pod.Spec.Containers[i].ReadinessProbe = probe
+		pod.Spec.Containers[i].StartupProbe = probe
+	}
+	return pod
+}
+
+func TestPodCopy(t *testing.T) {
+	defer cmd.SetClientset(nil)
+	defer cmd.SetCopyPod(false)
+	defer cmd.SetCopyChanges(nil, nil)
+	defer cmd.SetTTL(0)
+	defer cmd.SetContainer("")
+
+	tests := []struct {
+		name        string
+		copyPod     bool
+		setImage    map[string]string
+		overrides   []string
+		wantImages  map[string]string
+		wantCommand map[string][]string
+		wantErr     string
+	}{
+		{
+			name:        "Probes removed",
+			copyPod:     true,
+			wantImages:  map[string]string{"app": "myapp:1.0", "sidecar": "envoy:1.30"},
+			wantCommand: map[string][]string{"app": {"/app"}},
+		},
+		{
+			name:        "Set image and override command",
+			copyPod:     true,
+			setImage:    map[string]string{"app": "myapp:debug"},
+			overrides:   []string{"app=sleep,infinity"},
+			wantImages:  map[string]string{"app": "myapp:debug", "sidecar": "envoy:1.30"},
+			wantCommand: map[string][]string{"app": {"sleep", "infinity"}},
+		},
+		{
+			name:       "Set image of all containers",
+			copyPod:    true,
+			setImage:   map[string]string{"*": "busybox", "sidecar": "envoy:debug"},
+			wantImages: map[string]string{"app": "busybox", "sidecar": "envoy:debug"},
+		},
+		{
+			name:     "Unknown container",
+			copyPod:  true,
+			setImage: map[string]string{"web": "nginx"},
+			wantErr:  "container(s) web not found in pod test-pod, available containers: app, sidecar",
+		},
+		{
+			name:      "Invalid override",
+			copyPod:   true,
+			overrides: []string{"sleep,infinity"},
+			wantErr:   "invalid --override-command",
+		},
+		{
+			name:     "Without copy",
+			setImage: map[string]string{"app": "myapp:debug"},
+			wantErr:  "--set-image and --override-command require --copy",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := newClientset(newProbedPod("test-pod", "default"))
+			cmd.SetClientset(client)
+			cmd.SetNamespace("default")
+			cmd.SetPodName("test-pod")
+			cmd.SetContainer("app")
+			cmd.SetProfile("")
+			cmd.SetSession(false, false, false)
+			cmd.SetCopyPod(tt.copyPod)
+			cmd.SetTTL(time.Hour)
+
+			err := cmd.SetCopyChanges(tt.setImage, tt.overrides)
+			if err == nil {
+				err = cmd.RunDebug()
+			}
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("RunDebug() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("RunDebug() error = %v", err)
+			}
+
+			pods, _ := client.CoreV1().Pods("default").List(context.Background(), metav1.ListOptions{
+				LabelSelector: "debug-tool/target=test-pod",
+			})
+			if len(pods.Items) != 1 {
+				t.Fatalf("expected one pod copy, got %d", len(pods.Items))
+			}
+			podCopy := pods.Items[0]
+
+			if podCopy.Labels["debug-tool/type"] != "debug-pod" {
+				t.Errorf("labels = %v, want the copy labeled as a debug pod", podCopy.Labels)
+			}
+			if podCopy.Spec.NodeName != "" {
+				t.Errorf("nodeName = %q, want the copy scheduled anew", podCopy.Spec.NodeName)
+			}
+			if podCopy.Spec.ShareProcessNamespace == nil || !*podCopy.Spec.ShareProcessNamespace {
+				t.Errorf("shareProcessNamespace = %v, want true", podCopy.Spec.ShareProcessNamespace)
+			}
+			if podCopy.Spec.ActiveDeadlineSeconds == nil || *podCopy.Spec.ActiveDeadlineSeconds != 3600 {
+				t.Errorf("activeDeadlineSeconds = %v, want 3600", podCopy.Spec.ActiveDeadlineSeconds)
+			}
+			if len(podCopy.Spec.Containers) != 3 || podCopy.Spec.Containers[2].Name != "debugger" {
+				t.Fatalf("containers = %v, want app, sidecar and debugger", podCopy.Spec.Containers)
+			}
+
+			for _, c := range podCopy.Spec.Containers[:2] {
+				if c.LivenessProbe != nil || c.ReadinessProbe != nil || c.StartupProbe != nil {
+					t.Errorf("container %s kept its probes", c.Name)
+				}
+				if c.Image != tt.wantImages[c.Name] {
+					t.Errorf("container %s image = %s, want %s", c.Name, c.Image, tt.wantImages[c.Name])
+				}
+				if want, ok := tt.wantCommand[c.Name]; ok && !stringSliceEqual(c.Command, want) {
+					t.Errorf("container %s command = %v, want %v", c.Name, c.Command, want)
+				}
+			}
+			if len(tt.overrides) > 0 && len(podCopy.Spec.Containers[0].Args) != 0 {
+				t.Errorf("args = %v, want them cleared by --override-command", podCopy.Spec.Containers[0].Args)
+			}
+		})
+	}
+}
+
+func TestPodCopyProfile(t *testing.T) {
+	defer cmd.SetClientset(nil)
+	defer cmd.SetCopyPod(false)
+	defer cmd.SetProfile("")
+
+	client := newClientset(newTargetPod("test-pod", "default"))
+	cmd.SetClientset(client)
+	cmd.SetNamespace("default")
+	cmd.SetPodName("test-pod")
+	cmd.SetContainer("")
+	cmd.SetSession(false, false, false)
+	cmd.SetCopyPod(true)
+	cmd.SetProfile("baseline")
+
+	if err := cmd.RunDebug(); err != nil {
+		t.Fatalf("RunDebug() error = %v", err)
+	}
+
+	pods, _ := client.CoreV1().Pods("default").List(context.Background(), metav1.ListOptions{
+		LabelSelector: "debug-tool/target=test-pod",
+	})
+	if len(pods.Items) != 1 {
+		t.Fatalf("expected one pod copy, got %d", len(pods.Items))
+	}
+	containers := pods.Items[0].Spec.Containers
+	sc := containers[len(containers)-1].SecurityContext
+	if sc == nil || sc.AllowPrivilegeEscalation == nil || *sc.AllowPrivilegeEscalation {
+		t.Fatalf("debugger security context = %+v, want privilege escalation disallowed", sc)
+	}
+	if sc.Capabilities == nil || len(sc.Capabilities.Drop) != 1 || sc.Capabilities.Drop[0] != "ALL" {
+		t.Errorf("debugger capabilities = %+v, want ALL dropped", sc.Capabilities)
+	}
+	if sc.SeccompProfile == nil || sc.SeccompProfile.Type != corev1.SeccompProfileTypeRuntimeDefault {
+		t.Errorf("debugger seccomp profile = %+v, want RuntimeDefault", sc.SeccompProfile)
+	}
+}
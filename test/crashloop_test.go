@@ -0,0 +1,137 @@
+package test
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/jbuet/kubectl-debug/cmd"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// newCrashingPod returns a pod whose app container is in CrashLoopBackOff
+// next to a running sidecar
+func newCrashingPod(name, namespace string) *corev1.Pod {
+	pod := newProbedPod(name, namespace)
+	app := &pod.Spec.Containers[0]
+	app.Env = []corev1.EnvVar{
+		{Name: "PORT", Value: "8080"},
+		{Name: "GREETING", Value: "hello world"},
+		{Name: "DB_PASSWORD", ValueFrom: &corev1.EnvVarSource{
+			SecretKeyRef: &corev1.SecretKeySelector{
+				LocalObjectReference: corev1.LocalObjectReference{Name: "db"},
+				Key:                  "password",
+			},
+		}},
+	}
+	app.EnvFrom = []corev1.EnvFromSource{
+		{ConfigMapRef: &corev1.ConfigMapEnvSource{LocalObjectReference: corev1.LocalObjectReference{Name: "app-config"}}},
+	}
+	app.VolumeMounts = []corev1.VolumeMount{{Name: "data", MountPath: "/data"}}
+	pod.Spec.Volumes = []corev1.Volume{{Name: "data"}}
+	pod.Status.ContainerStatuses = []corev1.ContainerStatus{
+		{
+			Name:         "app",
+			RestartCount: 5,
+			State:        corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: "CrashLoopBackOff"}},
+		},
+		{
+			Name:  "sidecar",
+			Ready: true,
+			State: corev1.ContainerState{Running: &corev1.ContainerStateRunning{}},
+		},
+	}
+	return pod
+}
+
+func TestCrashLoop(t *testing.T) {
+	defer cmd.SetClientset(nil)
+	defer cmd.SetCrashLoop(false)
+	defer cmd.SetCopyChanges(nil, nil)
+	defer cmd.SetContainer("")
+	defer log.SetOutput(os.Stderr)
+
+	tests := []struct {
+		name      string
+		podName   string
+		container string
+		overrides []string
+		wantErr   string
+	}{
+		{name: "Restarting container detected", podName: "test-pod"},
+		{name: "Container not restarting", podName: "test-pod", container: "sidecar", wantErr: "container sidecar of pod test-pod is not restarting"},
+		{name: "Override of held container", podName: "test-pod", overrides: []string{"app=sh"}, wantErr: "--override-command cannot change container app"},
+		{name: "Node target", podName: "node/worker-1", wantErr: "--crashloop cannot be used with a node target"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := newClientset(newCrashingPod("test-pod", "default"))
+			cmd.SetClientset(client)
+			cmd.SetNamespace("default")
+			cmd.SetPodName(tt.podName)
+			cmd.SetContainer(tt.container)
+			cmd.SetProfile("")
+			cmd.SetSession(false, false, false)
+			cmd.SetCrashLoop(true)
+			var logs bytes.Buffer
+			log.SetOutput(&logs)
+
+			err := cmd.SetCopyChanges(nil, tt.overrides)
+			if err == nil {
+				err = cmd.RunDebug()
+			}
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("RunDebug() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("RunDebug() error = %v", err)
+			}
+
+			pods, _ := client.CoreV1().Pods("default").List(context.Background(), metav1.ListOptions{
+				LabelSelector: "debug-tool/target=test-pod",
+			})
+			if len(pods.Items) != 1 {
+				t.Fatalf("expected one pod copy, got %d", len(pods.Items))
+			}
+			spec := pods.Items[0].Spec
+			if spec.ShareProcessNamespace == nil || !*spec.ShareProcessNamespace {
+				t.Errorf("shareProcessNamespace = %v, want true", spec.ShareProcessNamespace)
+			}
+
+			app, sidecar, debugger := spec.Containers[0], spec.Containers[1], spec.Containers[2]
+			if !stringSliceEqual(app.Command, []string{"sleep", "infinity"}) || len(app.Args) != 0 {
+				t.Errorf("app command = %v %v, want it held by sleep infinity", app.Command, app.Args)
+			}
+			if app.LivenessProbe != nil || app.ReadinessProbe != nil || app.StartupProbe != nil {
+				t.Errorf("app kept its probes")
+			}
+			if sidecar.Command != nil {
+				t.Errorf("sidecar command = %v, want it unchanged", sidecar.Command)
+			}
+			if len(debugger.VolumeMounts) != 1 || debugger.VolumeMounts[0].MountPath != "/data" {
+				t.Errorf("debugger volume mounts = %v, want the app's", debugger.VolumeMounts)
+			}
+
+			for _, want := range []string{
+				"Container app is held by sleep infinity",
+				"  /app --port=8080\n",
+				"PORT=8080",
+				"GREETING='hello world'",
+				"DB_PASSWORD from key password of secret db",
+				"all keys of configmap app-config",
+			} {
+				if !strings.Contains(logs.String(), want) {
+					t.Errorf("output missing %q:\n%s", want, logs.String())
+				}
+			}
+		})
+	}
+}
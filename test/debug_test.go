@@ -1,108 +1,209 @@
 package test
 
 import (
+	"context"
 	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
 	"os"
-	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strconv"
 	"strings"
+	"sync"
 	"testing"
 
 	"github.com/jbuet/kubectl-debug/cmd"
+	appsv1 "k8s.io/api/apps/v1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/rest"
+	k8stesting "k8s.io/client-go/testing"
+	"k8s.io/client-go/tools/remotecommand"
+	utilexec "k8s.io/client-go/util/exec"
 )
 
-// MockCommand stores the last command execution for validation
-type MockCommand struct {
-	Command string
-	Args    []string
+// kubeconfig has a default context with the server given to Sprintf and a
+// prod context
+const kubeconfig = `apiVersion: v1
+kind: Config
+clusters:
+- name: default
+  cluster: {server: %s}
+- name: prod
+  cluster: {server: https://prod.example.com}
+users:
+- name: dev
+  user: {token: dev}
+contexts:
+- name: default
+  context: {cluster: default, user: dev}
+- name: prod
+  context: {cluster: prod, user: dev}
+current-context: default
+`
+
+// fakeSession is an exec or attach session the tool started
+type fakeSession struct {
+	Host        string
+	Pod         string
+	Subresource string
+	Container   string
+	Command     []string
 }
 
-var lastCommand MockCommand
-var mockShouldFail bool
+// fakeSessions records the exec and attach sessions of the tool and plays
+// their remote side: "exit N" writes to both streams and exits with N
+type fakeSessions struct {
+	mu       sync.Mutex
+	sessions []fakeSession
+	// fail makes every session fail to connect
+	fail bool
+	// exitCodes overrides the exit code of "exit N" in the given pods
+	exitCodes map[string]int
+}
 
-// Mock exec.Command
-func mockExecCommand(command string, args ...string) *exec.Cmd {
-	// Store the command for validation
-	lastCommand = MockCommand{
-		Command: command,
-		Args:    args,
+// useKubeconfig makes server the one of the default context of the
+// connection settings
+func useKubeconfig(t *testing.T, server string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config")
+	if err := os.WriteFile(path, []byte(fmt.Sprintf(kubeconfig, server)), 0o600); err != nil {
+		t.Fatal(err)
 	}
+	t.Setenv("KUBECONFIG", path)
+}
+
+// useFakeSessions streams the sessions of the CLI through a fakeSessions,
+// which never connects to the servers of the kubeconfig
+func useFakeSessions(t *testing.T) *fakeSessions {
+	t.Helper()
+	useKubeconfig(t, "https://default.example.com")
 
-	cs := []string{"-test.run=TestHelperProcess", "--", command}
-	cs = append(cs, args...)
-	cmd := exec.Command(os.Args[0], cs...)
-	cmd.Env = []string{"GO_WANT_HELPER_PROCESS=1"}
-	if mockShouldFail {
-		cmd.Env = append(cmd.Env, "GO_WANT_HELPER_PROCESS_FAIL=1")
+	s := &fakeSessions{}
+	cmd.SetSessionExecutor(s.executor)
+	t.Cleanup(func() { cmd.SetSessionExecutor(nil) })
+	return s
+}
+
+func (s *fakeSessions) executor(config *rest.Config, sessionURL *url.URL) (remotecommand.Executor, error) {
+	// The URL path is /api/v1/namespaces/NAMESPACE/pods/POD/SUBRESOURCE
+	parts := strings.Split(strings.Trim(sessionURL.Path, "/"), "/")
+	session := fakeSession{
+		Host:        sessionURL.Host,
+		Pod:         parts[len(parts)-2],
+		Subresource: parts[len(parts)-1],
+		Container:   sessionURL.Query().Get("container"),
+		Command:     sessionURL.Query()["command"],
 	}
-	return cmd
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sessions = append(s.sessions, session)
+	return &fakeExecutor{sessions: s, session: session}, nil
+}
+
+// recorded returns the sessions started so far
+func (s *fakeSessions) recorded() []fakeSession {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]fakeSession(nil), s.sessions...)
+}
+
+type fakeExecutor struct {
+	sessions *fakeSessions
+	session  fakeSession
 }
 
-// TestHelperProcess helps mock exec.Command
-func TestHelperProcess(t *testing.T) {
-	if os.Getenv("GO_WANT_HELPER_PROCESS") != "1" {
-		return
+func (e *fakeExecutor) Stream(options remotecommand.StreamOptions) error {
+	return e.StreamWithContext(context.Background(), options)
+}
+
+func (e *fakeExecutor) StreamWithContext(ctx context.Context, options remotecommand.StreamOptions) error {
+	e.sessions.mu.Lock()
+	fail := e.sessions.fail
+	code, override := e.sessions.exitCodes[e.session.Pod]
+	e.sessions.mu.Unlock()
+	if fail {
+		return fmt.Errorf("mock failure")
+	}
+
+	command := e.session.Command
+	if len(command) != 2 || command[0] != "exit" {
+		return nil
 	}
-	defer os.Exit(0)
+	if !override {
+		code, _ = strconv.Atoi(command[1])
+	}
+	fmt.Fprint(options.Stdout, "remote stdout")
+	if options.Stderr != nil {
+		fmt.Fprint(options.Stderr, "remote stderr")
+	}
+	if code != 0 {
+		return utilexec.CodeExitError{Err: fmt.Errorf("command terminated with exit code %d", code), Code: code}
+	}
+	return nil
+}
 
-	if os.Getenv("GO_WANT_HELPER_PROCESS_FAIL") == "1" {
-		fmt.Fprintf(os.Stderr, "mock failure")
-		os.Exit(1)
+// newTargetPod returns a running pod with a single nginx container
+func newTargetPod(name, namespace string) *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: namespace,
+			Labels:    map[string]string{"app": "nginx"},
+		},
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{
+				{Name: "nginx", Image: "nginx:latest"},
+			},
+		},
+		Status: corev1.PodStatus{Phase: corev1.PodRunning},
 	}
+}
 
-	args := os.Args
-	for len(args) > 0 {
-		if args[0] == "--" {
-			args = args[1:]
-			break
-		}
-		args = args[1:]
-	}
-
-	if len(args) == 0 {
-		fmt.Fprintf(os.Stderr, "No command\n")
-		os.Exit(2)
-	}
-
-	cmd, args := args[0], args[1:]
-	switch cmd {
-	case "kubectl":
-		if len(args) > 0 {
-			switch args[0] {
-			case "get":
-				if args[1] == "pod" {
-					switch {
-					case strings.Contains(strings.Join(args, " "), "custom-columns=:metadata.name"):
-						// Mock findExistingDebugPod
-						fmt.Println("debug-test-123")
-					case strings.Contains(strings.Join(args, " "), "jsonpath={.spec.containers[0].name}"):
-						// Mock getTargetContainerName
-						fmt.Println("nginx")
-					case strings.Contains(strings.Join(args, " "), "jsonpath={.metadata.labels}"):
-						// Mock getTargetPodLabels
-						fmt.Println("{\"app\":\"nginx\",\"debug-tool/type\":\"debug-pod\"}")
-					case strings.Contains(strings.Join(args, " "), "jsonpath={.spec.containers[0].image}"):
-						// Mock getTargetPodImage
-						fmt.Println("nginx:latest")
-					default:
-						// Mock pod existence check
-						if strings.Contains(strings.Join(args, " "), "nonexistent") {
-							os.Exit(1)
-						}
-					}
-					return
-				}
-			case "apply", "delete", "exec", "debug":
-				return
-			}
-		}
+// newDebugPod returns a pod labeled as created by kubectl-debug for the given target
+func newDebugPod(name, namespace, target string) *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: namespace,
+			Labels: map[string]string{
+				"debug-tool/type":   "debug-pod",
+				"debug-tool/target": target,
+			},
+		},
 	}
-	os.Exit(0)
+}
+
+// newClientset returns a fake clientset that allows every access review,
+// the fake one would deny them all
+func newClientset(objects ...runtime.Object) *fake.Clientset {
+	client := fake.NewSimpleClientset(objects...)
+	client.PrependReactor("create", "selfsubjectaccessreviews", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		review := action.(k8stesting.CreateAction).GetObject().(*authorizationv1.SelfSubjectAccessReview).DeepCopy()
+		review.Status.Allowed = true
+		return true, review, nil
+	})
+	return client
+}
+
+// failingClientset returns a fake clientset whose every call fails
+func failingClientset() *fake.Clientset {
+	client := newClientset()
+	client.PrependReactor("*", "*", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, fmt.Errorf("mock failure")
+	})
+	return client
 }
 
 func TestRunDebug(t *testing.T) {
-	origExecCommand := cmd.ExecCommand
-	defer func() { cmd.ExecCommand = origExecCommand }()
-	cmd.ExecCommand = mockExecCommand
+	useFakeSessions(t)
+	defer cmd.SetClientset(nil)
 
 	tests := []struct {
 		name       string
@@ -110,7 +211,6 @@ func TestRunDebug(t *testing.T) {
 		podName    string
 		image      string
 		copyPod    bool
-		shouldFail bool
 		wantErr    bool
 	}{
 		{
@@ -119,7 +219,6 @@ func TestRunDebug(t *testing.T) {
 			podName:    "",
 			image:     "debug:latest",
 			copyPod:   false,
-			shouldFail: false,
 			wantErr:    false,
 		},
 		{
@@ -128,7 +227,6 @@ func TestRunDebug(t *testing.T) {
 			podName:    "test-pod",
 			image:     "debug:latest",
 			copyPod:   true,
-			shouldFail: false,
 			wantErr:    false,
 		},
 		{
@@ -137,7 +235,6 @@ func TestRunDebug(t *testing.T) {
 			podName:    "test-pod",
 			image:     "debug:latest",
 			copyPod:   false,
-			shouldFail: false,
 			wantErr:    false,
 		},
 		{
@@ -146,7 +243,6 @@ func TestRunDebug(t *testing.T) {
 			podName:    "nonexistent",
 			image:     "debug:latest",
 			copyPod:   false,
-			shouldFail: true,
 			wantErr:    true,
 		},
 	}
@@ -157,7 +253,7 @@ func TestRunDebug(t *testing.T) {
 			cmd.SetPodName(tt.podName)
 			cmd.SetImage(tt.image)
 			cmd.SetCopyPod(tt.copyPod)
-			mockShouldFail = tt.shouldFail
+			cmd.SetClientset(newClientset(newTargetPod("test-pod", tt.namespace)))
 
 			err := cmd.RunDebug()
 			if (err != nil) != tt.wantErr {
@@ -168,39 +264,63 @@ func TestRunDebug(t *testing.T) {
 }
 
 func TestGetTargetContainerName(t *testing.T) {
-	origExecCommand := cmd.ExecCommand
-	defer func() { cmd.ExecCommand = origExecCommand }()
-	cmd.ExecCommand = mockExecCommand
+	defer cmd.SetClientset(nil)
+	defer cmd.SetContainer("")
+
+	// A meshed pod whose first container is the sidecar
+	meshed := newTargetPod("meshed-pod", "default")
+	meshed.Spec.Containers = []corev1.Container{
+		{Name: "istio-proxy", Image: "istio/proxyv2"},
+		{Name: "app", Image: "app:latest"},
+	}
+	annotated := meshed.DeepCopy()
+	annotated.Name = "annotated-pod"
+	annotated.Annotations = map[string]string{"kubectl.kubernetes.io/default-container": "app"}
 
 	tests := []struct {
-		name        string
-		namespace   string
-		podName     string
-		shouldFail  bool
-		wantErr     bool
-		wantName    string
-		wantCommand string
-		wantArgs    []string
+		name      string
+		namespace string
+		podName   string
+		container string
+		wantErr   bool
+		wantName  string
 	}{
 		{
-			name:        "Valid pod",
-			namespace:   "default",
-			podName:     "test-pod",
-			shouldFail:  false,
-			wantErr:     false,
-			wantName:    "nginx",
-			wantCommand: "kubectl",
-			wantArgs:    []string{"get", "pod", "test-pod", "-n", "default", "-o", "jsonpath={.spec.containers[0].name}"},
+			name:      "Valid pod",
+			namespace: "default",
+			podName:   "test-pod",
+			wantErr:   false,
+			wantName:  "nginx",
+		},
+		{
+			name:      "Invalid pod",
+			namespace: "default",
+			podName:   "nonexistent",
+			wantErr:   true,
+			wantName:  "",
+		},
+		{
+			name:      "Container flag",
+			namespace: "default",
+			podName:   "meshed-pod",
+			container: "app",
+			wantErr:   false,
+			wantName:  "app",
 		},
 		{
-			name:        "Invalid pod",
-			namespace:   "default",
-			podName:     "nonexistent",
-			shouldFail:  true,
-			wantErr:     true,
-			wantName:    "",
-			wantCommand: "kubectl",
-			wantArgs:    []string{"get", "pod", "nonexistent", "-n", "default"},
+			name:      "Unknown container flag",
+			namespace: "default",
+			podName:   "meshed-pod",
+			container: "worker",
+			wantErr:   true,
+			wantName:  "",
+		},
+		{
+			name:      "Default container annotation",
+			namespace: "default",
+			podName:   "annotated-pod",
+			wantErr:   false,
+			wantName:  "app",
 		},
 	}
 
@@ -208,8 +328,9 @@ func TestGetTargetContainerName(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			cmd.SetNamespace(tt.namespace)
 			cmd.SetPodName(tt.podName)
-			mockShouldFail = tt.shouldFail
-			
+			cmd.SetContainer(tt.container)
+			cmd.SetClientset(newClientset(newTargetPod("test-pod", tt.namespace), meshed, annotated))
+
 			got, err := cmd.GetTargetContainerName()
 			if (err != nil) != tt.wantErr {
 				t.Errorf("GetTargetContainerName() error = %v, wantErr %v", err, tt.wantErr)
@@ -223,45 +344,47 @@ func TestGetTargetContainerName(t *testing.T) {
 }
 
 func TestDeletePod(t *testing.T) {
-	origExecCommand := cmd.ExecCommand
-	defer func() { cmd.ExecCommand = origExecCommand }()
-	cmd.ExecCommand = mockExecCommand
+	defer cmd.SetClientset(nil)
 
 	tests := []struct {
-		name       string
-		podName    string
-		shouldFail bool
-		wantErr    bool
+		name    string
+		podName string
+		wantErr bool
 	}{
 		{
-			name:       "Successfully delete pod",
-			podName:    "test-pod",
-			shouldFail: false,
-			wantErr:    false,
+			name:    "Successfully delete pod",
+			podName: "test-pod",
+			wantErr: false,
 		},
 		{
-			name:       "Fail to delete pod",
-			podName:    "nonexistent",
-			shouldFail: true,
-			wantErr:    true,
+			name:    "Fail to delete pod",
+			podName: "nonexistent",
+			wantErr: true,
 		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			mockShouldFail = tt.shouldFail
+			cmd.SetNamespace("default")
+			client := newClientset(newTargetPod("test-pod", "default"))
+			cmd.SetClientset(client)
+
 			err := cmd.DeletePod(tt.podName)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("DeletePod() error = %v, wantErr %v", err, tt.wantErr)
 			}
+			if !tt.wantErr {
+				pods, _ := client.CoreV1().Pods("default").List(context.Background(), metav1.ListOptions{})
+				if len(pods.Items) != 0 {
+					t.Errorf("DeletePod() left %d pods behind", len(pods.Items))
+				}
+			}
 		})
 	}
 }
 
 func TestAttachToPod(t *testing.T) {
-	origExecCommand := cmd.ExecCommand
-	defer func() { cmd.ExecCommand = origExecCommand }()
-	cmd.ExecCommand = mockExecCommand
+	sessions := useFakeSessions(t)
 
 	tests := []struct {
 		name       string
@@ -285,7 +408,7 @@ func TestAttachToPod(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			mockShouldFail = tt.shouldFail
+			sessions.fail = tt.shouldFail
 			err := cmd.AttachToPod(tt.podName)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("AttachToPod() error = %v, wantErr %v", err, tt.wantErr)
@@ -294,10 +417,146 @@ func TestAttachToPod(t *testing.T) {
 	}
 }
 
+// newWorkloadObjects returns a deployment "api" with a healthy and a crashing
+// pod, a pod from an unrelated ReplicaSet sharing its labels and a service.
+func newWorkloadObjects() []runtime.Object {
+	labels := map[string]string{"app": "api"}
+	deployment := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: "api", Namespace: "default", UID: "deploy-uid"},
+		Spec:       appsv1.DeploymentSpec{Selector: &metav1.LabelSelector{MatchLabels: labels}},
+	}
+	replicaSet := &appsv1.ReplicaSet{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            "api-rs",
+			Namespace:       "default",
+			UID:             "rs-uid",
+			OwnerReferences: []metav1.OwnerReference{{Kind: "Deployment", Name: "api", UID: "deploy-uid", Controller: ptr(true)}},
+		},
+	}
+	pod := func(name, ownerUID string, ready bool, restarts int32) *corev1.Pod {
+		p := newTargetPod(name, "default")
+		p.Labels = labels
+		p.OwnerReferences = []metav1.OwnerReference{{Kind: "ReplicaSet", Name: "rs", UID: types.UID(ownerUID), Controller: ptr(true)}}
+		status := corev1.ConditionFalse
+		if ready {
+			status = corev1.ConditionTrue
+		}
+		p.Status.Conditions = []corev1.PodCondition{{Type: corev1.PodReady, Status: status}}
+		p.Status.ContainerStatuses = []corev1.ContainerStatus{{Name: "nginx", RestartCount: restarts}}
+		return p
+	}
+	service := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: "frontend", Namespace: "default"},
+		Spec:       corev1.ServiceSpec{Selector: labels},
+	}
+	return []runtime.Object{
+		deployment,
+		replicaSet,
+		pod("api-healthy", "rs-uid", true, 0),
+		pod("api-crashing", "rs-uid", false, 7),
+		pod("other-crashing", "other-uid", false, 20),
+		service,
+	}
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
+
+func TestResolveTargetPod(t *testing.T) {
+	defer cmd.SetClientset(nil)
+	defer cmd.SetUnhealthy(false)
+
+	tests := []struct {
+		name      string
+		target    string
+		unhealthy bool
+		wantPod   string
+		wantErr   bool
+	}{
+		{name: "Plain pod name", target: "test-pod", wantPod: "test-pod"},
+		{name: "Pod reference", target: "pod/test-pod", wantPod: "test-pod"},
+		{name: "Healthy deployment pod", target: "deploy/api", wantPod: "api-healthy"},
+		{name: "Least healthy deployment pod", target: "deployment/api", unhealthy: true, wantPod: "api-crashing"},
+		{name: "Service backing pod", target: "svc/frontend", wantPod: "api-healthy"},
+		{name: "Least healthy service pod", target: "svc/frontend", unhealthy: true, wantPod: "other-crashing"},
+		{name: "Missing deployment", target: "deploy/missing", wantErr: true},
+		{name: "Unsupported type", target: "cm/config", wantErr: true},
+		{name: "Missing name", target: "sts/", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd.SetNamespace("default")
+			cmd.SetPodName(tt.target)
+			cmd.SetUnhealthy(tt.unhealthy)
+			cmd.SetClientset(newClientset(newWorkloadObjects()...))
+
+			got, err := cmd.ResolveTargetPod()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ResolveTargetPod() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && got != tt.wantPod {
+				t.Errorf("ResolveTargetPod() = %v, want %v", got, tt.wantPod)
+			}
+		})
+	}
+}
+
+func TestSessionsUseConnectionFlags(t *testing.T) {
+	sessions := useFakeSessions(t)
+	defer cmd.SetKubeContext("")
+
+	cmd.SetNamespace("default")
+	cmd.SetKubeContext("prod")
+
+	if err := cmd.AttachToPod("test-pod"); err != nil {
+		t.Fatalf("AttachToPod() error = %v", err)
+	}
+
+	want := fakeSession{Host: "prod.example.com", Pod: "test-pod", Subresource: "exec", Container: "debugger", Command: []string{"sh"}}
+	got := sessions.recorded()
+	if len(got) != 1 || !reflect.DeepEqual(got[0], want) {
+		t.Errorf("AttachToPod() sessions = %+v, want %+v", got, want)
+	}
+}
+
+func TestSessionThroughAPIServer(t *testing.T) {
+	var mu sync.Mutex
+	var requests []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests = append(requests, r.URL.Path+"?"+r.URL.RawQuery)
+		mu.Unlock()
+		http.Error(w, "exec is forbidden", http.StatusForbidden)
+	}))
+	defer server.Close()
+	useKubeconfig(t, server.URL)
+	cmd.SetNamespace("default")
+
+	// Both WebSocket and its SPDY fallback are refused
+	err := cmd.AttachToPod("test-pod")
+	if err == nil {
+		t.Fatalf("AttachToPod() error = nil, want the refused upgrade")
+	}
+	if _, ok := err.(*cmd.CommandExitError); ok {
+		t.Fatalf("AttachToPod() error = %v, want a connection error", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(requests) == 0 {
+		t.Fatalf("no request reached the API server")
+	}
+	for _, request := range requests {
+		if !strings.HasPrefix(request, "/api/v1/namespaces/default/pods/test-pod/exec?") || !strings.Contains(request, "command=sh") || !strings.Contains(request, "container=debugger") {
+			t.Errorf("request = %s, want an exec of sh in the debugger", request)
+		}
+	}
+}
+
 func TestFindExistingDebugPod(t *testing.T) {
-	origExecCommand := cmd.ExecCommand
-	defer func() { cmd.ExecCommand = origExecCommand }()
-	cmd.ExecCommand = mockExecCommand
+	defer cmd.SetClientset(nil)
 
 	tests := []struct {
 		name       string
@@ -318,7 +577,15 @@ func TestFindExistingDebugPod(t *testing.T) {
 		{
 			name:       "No existing pod",
 			namespace:  "default",
-			podName:    "nonexistent",
+			podName:    "other-pod",
+			shouldFail: false,
+			wantPod:    "",
+			wantErr:    false,
+		},
+		{
+			name:       "API error",
+			namespace:  "default",
+			podName:    "test-pod",
 			shouldFail: true,
 			wantPod:    "",
 			wantErr:    true,
@@ -329,7 +596,11 @@ func TestFindExistingDebugPod(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			cmd.SetNamespace(tt.namespace)
 			cmd.SetPodName(tt.podName)
-			mockShouldFail = tt.shouldFail
+			if tt.shouldFail {
+				cmd.SetClientset(failingClientset())
+			} else {
+				cmd.SetClientset(newClientset(newDebugPod("debug-test-123", tt.namespace, "test-pod")))
+			}
 
 			got, err := cmd.FindExistingDebugPod()
 			if (err != nil) != tt.wantErr {
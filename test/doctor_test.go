@@ -0,0 +1,157 @@
+package test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jbuet/kubectl-debug/cmd"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/version"
+	fakediscovery "k8s.io/client-go/discovery/fake"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func newNode(name, kernel string, images ...string) *corev1.Node {
+	return &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Status: corev1.NodeStatus{
+			NodeInfo: corev1.NodeSystemInfo{KernelVersion: kernel},
+			Images:   []corev1.ContainerImage{{Names: images}},
+		},
+	}
+}
+
+// newDoctorClientset returns a fake cluster serving version and the core
+// resources, ephemeralcontainers included if requested
+func newDoctorClientset(ephemeral bool, objects ...runtime.Object) *fake.Clientset {
+	client := newClientset(objects...)
+	discovery := client.Discovery().(*fakediscovery.FakeDiscovery)
+	discovery.FakedServerVersion = &version.Info{GitVersion: "v1.31.2"}
+	resources := []metav1.APIResource{{Name: "pods"}}
+	if ephemeral {
+		resources = append(resources, metav1.APIResource{Name: "pods/ephemeralcontainers"})
+	}
+	discovery.Resources = []*metav1.APIResourceList{{GroupVersion: "v1", APIResources: resources}}
+	return client
+}
+
+// fakeKubectl puts a kubectl reporting its client version first in PATH
+func fakeKubectl(t *testing.T) {
+	t.Helper()
+	dir := t.TempDir()
+	script := "#!/bin/sh\necho '{\"clientVersion\":{\"gitVersion\":\"v1.32.3\"}}'\n"
+	if err := os.WriteFile(filepath.Join(dir, "kubectl"), []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+}
+
+func doctorStatuses(checks []cmd.DoctorCheck) map[string]string {
+	statuses := map[string]string{}
+	for _, c := range checks {
+		statuses[c.Name] = c.Status
+	}
+	return statuses
+}
+
+func TestDoctor(t *testing.T) {
+	fakeKubectl(t)
+	defer cmd.SetClientset(nil)
+	defer cmd.SetProfile("")
+	defer cmd.SetImage("jbuet/debug:latest")
+
+	tests := []struct {
+		name      string
+		ephemeral bool
+		objects   []runtime.Object
+		denied    []string
+		want      map[string]string
+	}{
+		{
+			name:      "Healthy cluster",
+			ephemeral: true,
+			objects:   []runtime.Object{newNode("worker-1", "6.1.0-18-amd64", "docker.io/jbuet/debug:latest")},
+			want: map[string]string{
+				"kubectl": "pass", "server": "pass", "ephemeral-containers": "pass", "debug-image": "pass",
+				"pod-security": "pass", "cgroups": "pass",
+				"access-standalone": "pass", "access-copy": "pass", "access-ephemeral": "pass",
+			},
+		},
+		{
+			name:    "Old cluster with a tenant role",
+			objects: []runtime.Object{newNode("worker-1", "4.14.336-256.559.amzn2.x86_64"), newPSANamespace("restricted")},
+			denied:  []string{"patch pods/ephemeralcontainers", "delete pods"},
+			want: map[string]string{
+				"ephemeral-containers": "fail", "pod-security": "warn", "cgroups": "warn",
+				"access-standalone": "warn", "access-copy": "warn", "access-ephemeral": "fail",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := newDoctorClientset(tt.ephemeral, tt.objects...)
+			denyAccess(client, tt.denied...)
+			cmd.SetClientset(client)
+			cmd.SetNamespace("default")
+			cmd.SetPodName("")
+			cmd.SetProfile("")
+			cmd.SetImage("jbuet/debug:latest")
+
+			got := doctorStatuses(cmd.RunDoctor())
+			for name, want := range tt.want {
+				if got[name] != want {
+					t.Errorf("check %s = %q, want %q (all: %v)", name, got[name], want, got)
+				}
+			}
+		})
+	}
+}
+
+func TestDoctorChecksToolkitImage(t *testing.T) {
+	fakeKubectl(t)
+	defer cmd.SetClientset(nil)
+	defer cmd.SetProfile("")
+	defer cmd.SetToolkit("", nil)
+	defer cmd.SetImage("jbuet/debug:latest")
+
+	client := newDoctorClientset(true, newNode("worker-1", "6.1.0-18-amd64", "docker.io/jbuet/debug:db"))
+	cmd.SetClientset(client)
+	cmd.SetNamespace("default")
+	cmd.SetPodName("")
+	cmd.SetProfile("")
+	cmd.SetImage("jbuet/debug:latest")
+	// The db toolkit selects the restricted profile, so its nonroot image
+	cmd.SetToolkit("db", nil)
+
+	for _, c := range cmd.RunDoctor() {
+		if c.Name != "debug-image" {
+			continue
+		}
+		if c.Status != "pass" || !strings.Contains(c.Message, "jbuet/debug:db") {
+			t.Errorf("debug-image check = %s %q, want a pass for jbuet/debug:db", c.Status, c.Message)
+		}
+		return
+	}
+	t.Error("no debug-image check")
+}
+
+func TestNormalizeImage(t *testing.T) {
+	tests := map[string]string{
+		"busybox":                        "docker.io/library/busybox:latest",
+		"jbuet/debug":                    "docker.io/jbuet/debug:latest",
+		"ghcr.io/org/tools:1.2":          "ghcr.io/org/tools:1.2",
+		"localhost:5000/tools":           "localhost:5000/tools:latest",
+		"jbuet/debug@sha256:0123abcd":    "docker.io/jbuet/debug@sha256:0123abcd",
+		"docker.io/library/busybox:1.36": "docker.io/library/busybox:1.36",
+	}
+	for ref, want := range tests {
+		if got := cmd.NormalizeImage(ref); got != want {
+			t.Errorf("NormalizeImage(%q) = %q, want %q", ref, got, want)
+		}
+	}
+}
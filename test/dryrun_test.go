@@ -0,0 +1,116 @@
+package test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/jbuet/kubectl-debug/cmd"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// captureStdout returns everything written to stdout while f runs
+func captureStdout(t *testing.T, f func() error) (string, error) {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("os.Pipe() error = %v", err)
+	}
+	orig := os.Stdout
+	os.Stdout = w
+
+	var buf bytes.Buffer
+	done := make(chan struct{})
+	go func() {
+		io.Copy(&buf, r)
+		close(done)
+	}()
+
+	runErr := f()
+	w.Close()
+	os.Stdout = orig
+	<-done
+	return buf.String(), runErr
+}
+
+func TestDryRun(t *testing.T) {
+	sessions := useFakeSessions(t)
+	defer cmd.SetClientset(nil)
+	defer cmd.SetDryRun("none", "yaml")
+	defer cmd.SetRunCommand(nil)
+
+	tests := []struct {
+		name     string
+		podName  string
+		copyPod  bool
+		command  []string
+		format   string
+		contains []string
+	}{
+		{
+			name:     "Standalone pod as YAML",
+			podName:  "",
+			format:   "yaml",
+			contains: []string{"kind: Pod", "name: debugger", "image: debug:latest"},
+		},
+		{
+			name:     "Standalone pod with a command",
+			podName:  "",
+			command:  []string{"ps", "aux"},
+			format:   "json",
+			contains: []string{`"command": [`, `"exec"`, `"-c",`, `"debugger",`, `"ps",`, `"aux"`},
+		},
+		{
+			name:     "Copy as JSON",
+			podName:  "test-pod",
+			copyPod:  true,
+			format:   "json",
+			contains: []string{`"name": "debug-test-pod-`, `"name": "debugger"`, `"shareProcessNamespace": true`},
+		},
+		{
+			name:     "Ephemeral container",
+			podName:  "test-pod",
+			format:   "yaml",
+			contains: []string{"ephemeralContainer:", "targetContainerName: nginx", "cpu: 100m"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := newClientset(newTargetPod("test-pod", "default"))
+			cmd.SetClientset(client)
+			cmd.SetNamespace("default")
+			cmd.SetPodName(tt.podName)
+			cmd.SetContainer("")
+			cmd.SetCopyPod(tt.copyPod)
+			cmd.SetImage("debug:latest")
+			cmd.SetRunCommand(tt.command)
+			cmd.SetDryRun("client", tt.format)
+
+			out, err := captureStdout(t, cmd.RunDebug)
+			if err != nil {
+				t.Fatalf("RunDebug() error = %v", err)
+			}
+			for _, want := range tt.contains {
+				if !strings.Contains(out, want) {
+					t.Errorf("dry-run output does not contain %q:\n%s", want, out)
+				}
+			}
+			if tt.format == "json" && !json.Valid([]byte(out)) {
+				t.Errorf("dry-run output is not valid JSON:\n%s", out)
+			}
+
+			pods, _ := client.CoreV1().Pods("default").List(context.Background(), metav1.ListOptions{})
+			if len(pods.Items) != 1 {
+				t.Errorf("dry run changed the cluster: %d pods", len(pods.Items))
+			}
+			if recorded := sessions.recorded(); len(recorded) != 0 {
+				t.Errorf("dry run started sessions %+v", recorded)
+			}
+		})
+	}
+}
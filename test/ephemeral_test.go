@@ -0,0 +1,117 @@
+package test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/jbuet/kubectl-debug/cmd"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// runningEphemeralContainers makes every ephemeral container of the pods
+// returned by the fake clientset report as running
+func runningEphemeralContainers(client *fake.Clientset) {
+	client.PrependReactor("get", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		get := action.(k8stesting.GetAction)
+		obj, err := client.Tracker().Get(corev1.SchemeGroupVersion.WithResource("pods"), get.GetNamespace(), get.GetName())
+		if err != nil {
+			return true, nil, err
+		}
+		pod := obj.(*corev1.Pod).DeepCopy()
+		pod.Status.EphemeralContainerStatuses = nil
+		for _, ec := range pod.Spec.EphemeralContainers {
+			pod.Status.EphemeralContainerStatuses = append(pod.Status.EphemeralContainerStatuses, corev1.ContainerStatus{
+				Name:  ec.Name,
+				State: corev1.ContainerState{Running: &corev1.ContainerStateRunning{StartedAt: metav1.Now()}},
+			})
+		}
+		return true, pod, nil
+	})
+}
+
+func TestEphemeralSecurityContext(t *testing.T) {
+	defer cmd.SetClientset(nil)
+	defer cmd.SetProfile("")
+
+	tests := []struct {
+		name      string
+		profile   string
+		runAsUser *int64
+		wantUser  *int64
+	}{
+		{name: "General without target user", profile: "", runAsUser: nil, wantUser: nil},
+		{name: "Target user is kept", profile: "", runAsUser: ptr(int64(2000)), wantUser: ptr(int64(2000))},
+		{name: "Restricted with non-root target", profile: "restricted", runAsUser: ptr(int64(2000)), wantUser: ptr(int64(2000))},
+		{name: "Restricted with root target", profile: "restricted", runAsUser: ptr(int64(0)), wantUser: ptr(int64(1000))},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			target := newTargetPod("test-pod", "default")
+			target.Spec.Containers[0].SecurityContext = &corev1.SecurityContext{RunAsUser: tt.runAsUser}
+			client := newClientset(target)
+			cmd.SetClientset(client)
+			cmd.SetNamespace("default")
+			cmd.SetPodName("test-pod")
+			cmd.SetContainer("")
+			cmd.SetCopyPod(false)
+			cmd.SetProfile(tt.profile)
+
+			if err := cmd.RunDebug(); err != nil {
+				t.Fatalf("RunDebug() error = %v", err)
+			}
+
+			pod, _ := client.CoreV1().Pods("default").Get(context.Background(), "test-pod", metav1.GetOptions{})
+			if len(pod.Spec.EphemeralContainers) != 1 {
+				t.Fatalf("expected one ephemeral container, got %d", len(pod.Spec.EphemeralContainers))
+			}
+			sc := pod.Spec.EphemeralContainers[0].SecurityContext
+			if sc == nil || sc.SeccompProfile == nil {
+				t.Fatalf("ephemeral container security context = %+v, want the profile's", sc)
+			}
+			if (sc.RunAsUser == nil) != (tt.wantUser == nil) || (sc.RunAsUser != nil && *sc.RunAsUser != *tt.wantUser) {
+				t.Errorf("RunAsUser = %v, want %v", sc.RunAsUser, tt.wantUser)
+			}
+			if tt.profile == "restricted" && (sc.Capabilities == nil || len(sc.Capabilities.Drop) == 0) {
+				t.Errorf("restricted profile capabilities not applied: %+v", sc.Capabilities)
+			}
+		})
+	}
+}
+
+func TestEphemeralRemoveAfter(t *testing.T) {
+	sessions := useFakeSessions(t)
+	defer cmd.SetClientset(nil)
+	defer cmd.SetSession(false, false, false)
+
+	client := newClientset(newTargetPod("test-pod", "default"))
+	runningEphemeralContainers(client)
+	cmd.SetClientset(client)
+	cmd.SetNamespace("default")
+	cmd.SetPodName("test-pod")
+	cmd.SetContainer("")
+	cmd.SetCopyPod(false)
+	cmd.SetProfile("")
+	cmd.SetSession(true, true, true)
+
+	if err := cmd.RunDebug(); err != nil {
+		t.Fatalf("RunDebug() error = %v", err)
+	}
+
+	recorded := sessions.recorded()
+	if len(recorded) != 2 {
+		t.Fatalf("expected attach and exec, got %+v", recorded)
+	}
+	attach, kill := recorded[0], recorded[1]
+	if attach.Subresource != "attach" || !strings.HasPrefix(attach.Container, "debugger-") {
+		t.Errorf("first session = %+v, want an attach to the debugger", attach)
+	}
+	if kill.Subresource != "exec" || kill.Container != attach.Container || !strings.Contains(strings.Join(kill.Command, " "), "DEBUG_TOOL_SESSION "+attach.Container) {
+		t.Errorf("second session = %+v, want an exec stopping the debugger", kill)
+	}
+}
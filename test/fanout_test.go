@@ -0,0 +1,149 @@
+package test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jbuet/kubectl-debug/cmd"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestValidateFanOut(t *testing.T) {
+	defer cmd.SetFanOut(false, 5, "prefix")
+	defer cmd.SetRunCommand(nil)
+	defer cmd.SetSelector("")
+	defer cmd.SetPodName("")
+	defer cmd.SetCopyPod(false)
+
+	tests := []struct {
+		name     string
+		podName  string
+		selector string
+		command  []string
+		copyPod  bool
+		limit    int
+		output   string
+		wantErr  string
+	}{
+		{name: "Workload", podName: "deploy/api", command: []string{"date"}, limit: 5, output: "prefix"},
+		{name: "Selector with JSON", selector: "app=api", command: []string{"date"}, limit: 1, output: "json"},
+		{name: "Without command", podName: "deploy/api", limit: 5, output: "prefix", wantErr: "requires a command"},
+		{name: "Single pod", podName: "api-0", command: []string{"date"}, limit: 5, output: "prefix", wantErr: "requires a workload"},
+		{name: "Copy", podName: "deploy/api", command: []string{"date"}, copyPod: true, limit: 5, output: "prefix", wantErr: "--copy"},
+		{name: "No concurrency", podName: "deploy/api", command: []string{"date"}, limit: 0, output: "prefix", wantErr: "--concurrency"},
+		{name: "Unknown output", podName: "deploy/api", command: []string{"date"}, limit: 5, output: "yaml", wantErr: "--all-output"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd.SetPodName(tt.podName)
+			cmd.SetSelector(tt.selector)
+			cmd.SetRunCommand(tt.command)
+			cmd.SetCopyPod(tt.copyPod)
+			cmd.SetFanOut(true, tt.limit, tt.output)
+
+			err := cmd.ValidateFanOut()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("ValidateFanOut() error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("ValidateFanOut() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestFanOut(t *testing.T) {
+	defer cmd.SetClientset(nil)
+	defer cmd.SetFanOut(false, 5, "prefix")
+	defer cmd.SetRunCommand(nil)
+	defer cmd.SetSelector("")
+	defer cmd.SetWaitTimeout(30 * time.Second)
+	cmd.SetWaitTimeout(time.Second)
+
+	newReplica := func(name string, phase corev1.PodPhase) *corev1.Pod {
+		pod := newTargetPod(name, "default")
+		pod.Labels = map[string]string{"app": "api"}
+		pod.Status.Phase = phase
+		return pod
+	}
+
+	for _, output := range []string{"prefix", "json"} {
+		t.Run(output, func(t *testing.T) {
+			sessions := useFakeSessions(t)
+			// The command fails in api-2 only
+			sessions.exitCodes = map[string]int{"api-2": 2}
+
+			client := newClientset(
+				newReplica("api-0", corev1.PodRunning),
+				newReplica("api-1", corev1.PodRunning),
+				newReplica("api-2", corev1.PodRunning),
+				newReplica("api-3", corev1.PodPending),
+			)
+			runningPods(client)
+			cmd.SetClientset(client)
+			cmd.SetNamespace("default")
+			cmd.SetPodName("")
+			cmd.SetSelector("app=api")
+			cmd.SetContainer("")
+			cmd.SetProfile("")
+			cmd.SetSession(false, false, false)
+			cmd.SetRunCommand([]string{"exit", "0"})
+			cmd.SetFanOut(true, 2, output)
+
+			out, err := captureStdout(t, cmd.RunDebug)
+
+			var exitErr *cmd.CommandExitError
+			if !errors.As(err, &exitErr) || exitErr.Code != 2 {
+				t.Fatalf("RunDebug() error = %v, want exit code 2", err)
+			}
+
+			lines := strings.Split(strings.TrimSpace(out), "\n")
+			sort.Strings(lines)
+			if len(lines) != 3 {
+				t.Fatalf("expected one output line per running pod, got:\n%s", out)
+			}
+			for i, line := range lines {
+				pod := []string{"api-0", "api-1", "api-2"}[i]
+				if output == "prefix" {
+					if line != pod+" | remote stdout" {
+						t.Errorf("line %d = %q, want the output prefixed with %s", i, line, pod)
+					}
+					continue
+				}
+				var result cmd.FanOutResult
+				if err := json.Unmarshal([]byte(line), &result); err != nil {
+					t.Fatalf("line %d is not JSON: %q", i, line)
+				}
+				wantCode := 0
+				if pod == "api-2" {
+					wantCode = 2
+				}
+				if result.Pod != pod || result.ExitCode == nil || *result.ExitCode != wantCode ||
+					result.Stdout != "remote stdout" || result.Stderr != "remote stderr" {
+					t.Errorf("result %d = %+v, want pod %s exiting with %d", i, result, pod, wantCode)
+				}
+			}
+
+			pods, _ := client.CoreV1().Pods("default").List(context.Background(), metav1.ListOptions{})
+			for _, pod := range pods.Items {
+				want := 1
+				if pod.Name == "api-3" {
+					want = 0
+				}
+				if len(pod.Spec.EphemeralContainers) != want {
+					t.Errorf("pod %s has %d ephemeral containers, want %d", pod.Name, len(pod.Spec.EphemeralContainers), want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,140 @@
+package test
+
+import (
+	"context"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/jbuet/kubectl-debug/cmd"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// newAgedDebugPod returns a debug pod created age ago by creator
+func newAgedDebugPod(name, target, creator string, age time.Duration) *corev1.Pod {
+	pod := newDebugPod(name, "default", target)
+	pod.CreationTimestamp = metav1.NewTime(time.Now().Add(-age))
+	pod.Spec.Containers = []corev1.Container{{
+		Name:  "debugger",
+		Image: "debug:latest",
+		Env: []corev1.EnvVar{
+			{Name: "DEBUG_TOOL_TARGET", Value: target},
+			{Name: "DEBUG_TOOL_CREATOR", Value: creator},
+		},
+	}}
+	pod.Status.Phase = corev1.PodRunning
+	return pod
+}
+
+func TestRunGC(t *testing.T) {
+	defer cmd.SetClientset(nil)
+	defer cmd.SetGCFilters(0, "", "", false)
+	defer cmd.SetGCDryRun(false)
+	defer cmd.SetForce(false)
+
+	newObjects := func() []runtime.Object {
+		expired := newAgedDebugPod("debug-expired", "api-0", "bob", 3*time.Hour)
+		expired.Annotations = map[string]string{"debug-tool/expires-at": time.Now().Add(-time.Hour).UTC().Format(time.RFC3339)}
+		failed := newAgedDebugPod("debug-failed", "db-0", "bob", 10*time.Minute)
+		failed.Status.Phase = corev1.PodFailed
+		// A workload setting the debug environment without the labels of the tool
+		unlabeled := newAgedDebugPod("worker-0", "api-0", "alice", 5*time.Hour)
+		unlabeled.Labels = map[string]string{"app": "worker"}
+		return []runtime.Object{
+			newAgedDebugPod("debug-old", "api-0", "alice", 5*time.Hour),
+			newAgedDebugPod("debug-new", "api-0", "alice", 5*time.Minute),
+			expired,
+			failed,
+			unlabeled,
+			newTargetPod("api-0", "default"),
+		}
+	}
+
+	tests := []struct {
+		name      string
+		olderThan time.Duration
+		target    string
+		creator   string
+		expired   bool
+		dryRun    bool
+		wantLeft  []string
+	}{
+		{
+			name:      "Older than",
+			olderThan: 2 * time.Hour,
+			wantLeft:  []string{"api-0", "debug-failed", "debug-new", "worker-0"},
+		},
+		{
+			name:     "By target and creator",
+			target:   "api-0",
+			creator:  "alice",
+			wantLeft: []string{"api-0", "debug-expired", "debug-failed", "worker-0"},
+		},
+		{
+			name:     "Expired or finished",
+			expired:  true,
+			wantLeft: []string{"api-0", "debug-new", "debug-old", "worker-0"},
+		},
+		{
+			name:     "Dry run deletes nothing",
+			dryRun:   true,
+			wantLeft: []string{"api-0", "debug-expired", "debug-failed", "debug-new", "debug-old", "worker-0"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := newClientset(newObjects()...)
+			cmd.SetClientset(client)
+			cmd.SetNamespace("default")
+			cmd.SetAllNamespaces(false)
+			cmd.SetForce(true)
+			cmd.SetGCFilters(tt.olderThan, tt.target, tt.creator, tt.expired)
+			cmd.SetGCDryRun(tt.dryRun)
+
+			if err := cmd.RunGC(); err != nil {
+				t.Fatalf("RunGC() error = %v", err)
+			}
+
+			pods, _ := client.CoreV1().Pods("default").List(context.Background(), metav1.ListOptions{})
+			var left []string
+			for _, pod := range pods.Items {
+				left = append(left, pod.Name)
+			}
+			sort.Strings(left)
+			if !stringSliceEqual(left, tt.wantLeft) {
+				t.Errorf("pods left after gc = %v, want %v", left, tt.wantLeft)
+			}
+		})
+	}
+}
+
+func TestTTLIsRecorded(t *testing.T) {
+	defer cmd.SetClientset(nil)
+	defer cmd.SetTTL(0)
+
+	client := newClientset()
+	cmd.SetClientset(client)
+	cmd.SetNamespace("default")
+	cmd.SetPodName("")
+	cmd.SetProfile("")
+	cmd.SetTTL(2 * time.Hour)
+
+	if err := cmd.RunDebug(); err != nil {
+		t.Fatalf("RunDebug() error = %v", err)
+	}
+
+	pods, _ := client.CoreV1().Pods("default").List(context.Background(), metav1.ListOptions{})
+	if len(pods.Items) != 1 {
+		t.Fatalf("expected one debug pod, got %d", len(pods.Items))
+	}
+	pod := pods.Items[0]
+	if pod.Spec.ActiveDeadlineSeconds == nil || *pod.Spec.ActiveDeadlineSeconds != 7200 {
+		t.Errorf("ActiveDeadlineSeconds = %v, want 7200", pod.Spec.ActiveDeadlineSeconds)
+	}
+	if pod.Annotations["debug-tool/ttl"] != "2h0m0s" || pod.Annotations["debug-tool/expires-at"] == "" {
+		t.Errorf("TTL annotations = %v", pod.Annotations)
+	}
+}
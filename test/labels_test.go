@@ -0,0 +1,208 @@
+package test
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/jbuet/kubectl-debug/cmd"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func ownedBy(kind, name string) []metav1.OwnerReference {
+	return []metav1.OwnerReference{{Kind: kind, Name: name, Controller: ptr(true)}}
+}
+
+func newService(name string, selector map[string]string) *corev1.Service {
+	return &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"},
+		Spec:       corev1.ServiceSpec{Selector: selector},
+	}
+}
+
+func TestCopyLabels(t *testing.T) {
+	defer cmd.SetClientset(nil)
+	defer cmd.SetCopyPod(false)
+	defer cmd.SetKeepServiceTraffic(false)
+	defer log.SetOutput(os.Stderr)
+
+	objectMeta := func(name string, owners []metav1.OwnerReference) metav1.ObjectMeta {
+		return metav1.ObjectMeta{Name: name, Namespace: "default", OwnerReferences: owners}
+	}
+	selector := func(matchLabels map[string]string) *metav1.LabelSelector {
+		return &metav1.LabelSelector{MatchLabels: matchLabels}
+	}
+
+	tests := []struct {
+		name        string
+		labels      map[string]string
+		owners      []metav1.OwnerReference
+		objects     []runtime.Object
+		keepTraffic bool
+		want        map[string]string
+		wantWarning string
+	}{
+		{
+			name:   "Deployment",
+			labels: map[string]string{"app": "api", "pod-template-hash": "5d9f", "team": "payments"},
+			owners: ownedBy("ReplicaSet", "api-5d9f"),
+			objects: []runtime.Object{
+				&appsv1.ReplicaSet{
+					ObjectMeta: objectMeta("api-5d9f", ownedBy("Deployment", "api")),
+					Spec:       appsv1.ReplicaSetSpec{Selector: selector(map[string]string{"app": "api", "pod-template-hash": "5d9f"})},
+				},
+				&appsv1.Deployment{
+					ObjectMeta: objectMeta("api", nil),
+					Spec:       appsv1.DeploymentSpec{Selector: selector(map[string]string{"app": "api"})},
+				},
+			},
+			want: map[string]string{"team": "payments"},
+		},
+		{
+			name:   "Deployment keeping Service traffic",
+			labels: map[string]string{"app": "api", "pod-template-hash": "5d9f", "team": "payments"},
+			owners: ownedBy("ReplicaSet", "api-5d9f"),
+			objects: []runtime.Object{
+				&appsv1.ReplicaSet{
+					ObjectMeta: objectMeta("api-5d9f", ownedBy("Deployment", "api")),
+					Spec:       appsv1.ReplicaSetSpec{Selector: selector(map[string]string{"app": "api", "pod-template-hash": "5d9f"})},
+				},
+				&appsv1.Deployment{
+					ObjectMeta: objectMeta("api", nil),
+					Spec:       appsv1.DeploymentSpec{Selector: selector(map[string]string{"app": "api"})},
+				},
+				newService("api", map[string]string{"app": "api"}),
+			},
+			keepTraffic: true,
+			want:        map[string]string{"app": "api", "team": "payments"},
+		},
+		{
+			name:   "Bare ReplicaSet with expressions",
+			labels: map[string]string{"app": "web", "tier": "frontend"},
+			owners: ownedBy("ReplicaSet", "web"),
+			objects: []runtime.Object{
+				&appsv1.ReplicaSet{
+					ObjectMeta: objectMeta("web", nil),
+					Spec: appsv1.ReplicaSetSpec{Selector: &metav1.LabelSelector{
+						MatchExpressions: []metav1.LabelSelectorRequirement{
+							{Key: "app", Operator: metav1.LabelSelectorOpIn, Values: []string{"web"}},
+						},
+					}},
+				},
+			},
+			want: map[string]string{"tier": "frontend"},
+		},
+		{
+			name:   "StatefulSet and per-pod Service",
+			labels: map[string]string{"app": "db", "statefulset.kubernetes.io/pod-name": "db-0", "tier": "data"},
+			owners: ownedBy("StatefulSet", "db"),
+			objects: []runtime.Object{
+				&appsv1.StatefulSet{
+					ObjectMeta: objectMeta("db", nil),
+					Spec:       appsv1.StatefulSetSpec{Selector: selector(map[string]string{"app": "db"})},
+				},
+				newService("db-0", map[string]string{"statefulset.kubernetes.io/pod-name": "db-0"}),
+				newService("cache", map[string]string{"app": "cache"}),
+			},
+			want: map[string]string{"tier": "data"},
+		},
+		{
+			name:   "StatefulSet keeping Service traffic",
+			labels: map[string]string{"app": "db", "tier": "data"},
+			owners: ownedBy("StatefulSet", "db"),
+			objects: []runtime.Object{
+				&appsv1.StatefulSet{
+					ObjectMeta: objectMeta("db", nil),
+					Spec:       appsv1.StatefulSetSpec{Selector: selector(map[string]string{"app": "db"})},
+				},
+				newService("db", map[string]string{"app": "db"}),
+			},
+			keepTraffic: true,
+			want:        map[string]string{"app": "db", "tier": "data"},
+			wantWarning: "StatefulSet db still selects the labels kept for --keep-service-traffic and may adopt the debug pod",
+		},
+		{
+			name:   "DaemonSet",
+			labels: map[string]string{"name": "agent", "controller-revision-hash": "7c9"},
+			owners: ownedBy("DaemonSet", "agent"),
+			objects: []runtime.Object{
+				&appsv1.DaemonSet{
+					ObjectMeta: objectMeta("agent", nil),
+					Spec:       appsv1.DaemonSetSpec{Selector: selector(map[string]string{"name": "agent"})},
+				},
+			},
+			want: map[string]string{"controller-revision-hash": "7c9"},
+		},
+		{
+			name:   "CronJob",
+			labels: map[string]string{"batch.kubernetes.io/controller-uid": "uid-1", "job-name": "backup-1", "app": "backup"},
+			owners: ownedBy("Job", "backup-1"),
+			objects: []runtime.Object{
+				&batchv1.Job{
+					ObjectMeta: objectMeta("backup-1", ownedBy("CronJob", "backup")),
+					Spec:       batchv1.JobSpec{Selector: selector(map[string]string{"batch.kubernetes.io/controller-uid": "uid-1"})},
+				},
+				&batchv1.CronJob{ObjectMeta: objectMeta("backup", nil)},
+			},
+			want: map[string]string{"job-name": "backup-1", "app": "backup"},
+		},
+		{
+			name:   "Unknown owner",
+			labels: map[string]string{"app": "rollout"},
+			owners: ownedBy("Rollout", "api"),
+			want:   map[string]string{"app": "rollout"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			target := newTargetPod("test-pod", "default")
+			target.Labels = tt.labels
+			target.OwnerReferences = tt.owners
+			client := newClientset(append(tt.objects, target)...)
+			cmd.SetClientset(client)
+			cmd.SetNamespace("default")
+			cmd.SetPodName("test-pod")
+			cmd.SetContainer("")
+			cmd.SetProfile("")
+			cmd.SetSession(false, false, false)
+			cmd.SetCopyPod(true)
+			cmd.SetKeepServiceTraffic(tt.keepTraffic)
+			var logs bytes.Buffer
+			log.SetOutput(&logs)
+
+			if err := cmd.RunDebug(); err != nil {
+				t.Fatalf("RunDebug() error = %v", err)
+			}
+
+			pods, _ := client.CoreV1().Pods("default").List(context.Background(), metav1.ListOptions{
+				LabelSelector: "debug-tool/target=test-pod",
+			})
+			if len(pods.Items) != 1 {
+				t.Fatalf("expected one pod copy, got %d", len(pods.Items))
+			}
+			got := pods.Items[0].Labels
+			delete(got, "debug-tool/type")
+			delete(got, "debug-tool/target")
+			delete(got, "debug-tool/mode")
+			if len(got) != len(tt.want) {
+				t.Fatalf("labels = %v, want %v", got, tt.want)
+			}
+			for key, value := range tt.want {
+				if got[key] != value {
+					t.Errorf("labels = %v, want %v", got, tt.want)
+				}
+			}
+			if !strings.Contains(logs.String(), tt.wantWarning) {
+				t.Errorf("output missing %q:\n%s", tt.wantWarning, logs.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,150 @@
+package test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/jbuet/kubectl-debug/debug"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestLibraryConcurrentRuns(t *testing.T) {
+	const runs = 4
+
+	var wg sync.WaitGroup
+	sessions := make([]*debug.Session, runs)
+	errs := make([]error, runs)
+
+	for i := 0; i < runs; i++ {
+		namespace := fmt.Sprintf("team-%d", i)
+		client := newClientset(newTargetPod("api", namespace))
+		runningEphemeralContainers(client)
+
+		opts := debug.DefaultOptions()
+		opts.Namespace = namespace
+		opts.Pod = "api"
+		opts.Image = fmt.Sprintf("registry.example.com/debug:%d", i)
+		opts.ProfilesFile = ""
+		opts.ProfilesConfigMap = ""
+		opts.Clientset = client
+
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			sessions[i], errs[i] = debug.Run(context.Background(), opts)
+			if errs[i] != nil {
+				return
+			}
+
+			// Every caller only sees its own cluster and options
+			pod, err := client.CoreV1().Pods(namespace).Get(context.Background(), "api", metav1.GetOptions{})
+			if err != nil {
+				errs[i] = err
+				return
+			}
+			if len(pod.Spec.EphemeralContainers) != 1 || pod.Spec.EphemeralContainers[0].Image != opts.Image {
+				errs[i] = fmt.Errorf("ephemeral containers = %+v, want one with image %s", pod.Spec.EphemeralContainers, opts.Image)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	for i := 0; i < runs; i++ {
+		if errs[i] != nil {
+			t.Fatalf("run %d: %v", i, errs[i])
+		}
+		s := sessions[i]
+		if s.Mode != debug.ModeEphemeral || s.Namespace != fmt.Sprintf("team-%d", i) || s.Pod != "api" || s.Target != "api" {
+			t.Errorf("run %d session = %+v", i, s)
+		}
+	}
+}
+
+func TestLibraryCreateAndCleanup(t *testing.T) {
+	sessions := useFakeSessions(t)
+
+	client := newClientset(newTargetPod("api", "default"))
+	runningEphemeralContainers(client)
+
+	opts := debug.DefaultOptions()
+	opts.Namespace = "default"
+	opts.Pod = "api"
+	opts.ProfilesFile = ""
+	opts.ProfilesConfigMap = ""
+	opts.Clientset = client
+	d := debug.New(opts)
+	d.SetSessionExecutor(sessions.executor)
+
+	session, err := d.Create(context.Background())
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	if session.Container == "" {
+		t.Fatalf("Create() session = %+v, want the ephemeral container", session)
+	}
+	if recorded := sessions.recorded(); len(recorded) != 0 {
+		t.Errorf("Create() started sessions %+v, want API calls only", recorded)
+	}
+
+	if err := session.Cleanup(context.Background()); err != nil {
+		t.Fatalf("Cleanup() error = %v", err)
+	}
+	recorded := sessions.recorded()
+	if len(recorded) != 1 || recorded[0].Subresource != "exec" || recorded[0].Pod != "api" || recorded[0].Container != session.Container {
+		t.Errorf("Cleanup() started sessions %+v, want an exec in %s", recorded, session.Container)
+	}
+}
+
+func TestLibraryLogger(t *testing.T) {
+	const runs = 4
+
+	// Previews must not touch the standard logger, which other
+	// Debuggers may be writing to
+	var global bytes.Buffer
+	log.SetOutput(&global)
+	defer log.SetOutput(os.Stderr)
+
+	var wg sync.WaitGroup
+	logs := make([]bytes.Buffer, runs)
+	errs := make([]error, runs)
+	for i := 0; i < runs; i++ {
+		client := newClientset(newPSANamespace("baseline"), newTargetPod("api", "default"))
+		runningEphemeralContainers(client)
+
+		opts := debug.DefaultOptions()
+		opts.Namespace = "default"
+		opts.Pod = "api"
+		opts.ProfilesFile = ""
+		opts.ProfilesConfigMap = ""
+		opts.Clientset = client
+		opts.Logger = log.New(&logs[i], "", 0)
+
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, errs[i] = debug.Run(context.Background(), opts)
+		}(i)
+	}
+	wg.Wait()
+
+	if log.Writer() != &global {
+		t.Fatalf("the standard logger output was changed")
+	}
+	if global.Len() != 0 {
+		t.Errorf("standard logger got %q, want every message in the Debugger's logger", global.String())
+	}
+	for i := 0; i < runs; i++ {
+		if errs[i] != nil {
+			t.Fatalf("run %d: %v", i, errs[i])
+		}
+		if !strings.Contains(logs[i].String(), "Adding debug container") {
+			t.Errorf("run %d logged %q", i, logs[i].String())
+		}
+	}
+}
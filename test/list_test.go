@@ -0,0 +1,116 @@
+package test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/jbuet/kubectl-debug/cmd"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestListDebugSessions(t *testing.T) {
+	defer cmd.SetClientset(nil)
+	defer cmd.SetAllNamespaces(false)
+
+	markers := []corev1.EnvVar{
+		{Name: "DEBUG_TOOL_TARGET", Value: "api-0"},
+		{Name: "DEBUG_TOOL_PROFILE", Value: "restricted"},
+		{Name: "DEBUG_TOOL_CREATOR", Value: "alice"},
+	}
+
+	standalone := newDebugPod("debug-123", "default", "")
+	standalone.Spec.Containers = []corev1.Container{{Name: "debugger", Image: "debug:latest"}}
+
+	withEphemeral := newTargetPod("api-0", "default")
+	withEphemeral.Spec.EphemeralContainers = []corev1.EphemeralContainer{
+		{EphemeralContainerCommon: corev1.EphemeralContainerCommon{Name: "debugger-abcde", Image: "debug:latest", Env: markers}},
+		{EphemeralContainerCommon: corev1.EphemeralContainerCommon{Name: "someone-else", Image: "busybox"}},
+	}
+	withEphemeral.Status.EphemeralContainerStatuses = []corev1.ContainerStatus{
+		{Name: "debugger-abcde", State: corev1.ContainerState{Running: &corev1.ContainerStateRunning{}}},
+	}
+
+	// Copies made by kubectl debug are only marked by their environment
+	legacyCopy := newTargetPod("debug-api-0-copy", "default")
+	legacyCopy.Spec.Containers = append(legacyCopy.Spec.Containers, corev1.Container{Name: "debugger", Image: "debug:latest", Env: markers})
+
+	otherNamespace := newDebugPod("debug-456", "other", "db-0")
+	otherNamespace.Spec.Containers = []corev1.Container{{Name: "debugger", Image: "debug:latest"}}
+
+	client := newClientset(standalone, withEphemeral, legacyCopy, otherNamespace, newTargetPod("api-1", "default"))
+
+	// Copies are created the way the copy mode creates them
+	cmd.SetClientset(client)
+	cmd.SetNamespace("default")
+	cmd.SetPodName("api-1")
+	cmd.SetContainer("")
+	cmd.SetProfile("")
+	cmd.SetSession(false, false, false)
+	cmd.SetCopyPod(true)
+	err := cmd.RunDebug()
+	cmd.SetCopyPod(false)
+	if err != nil {
+		t.Fatalf("RunDebug() error = %v", err)
+	}
+	copies, _ := client.CoreV1().Pods("default").List(context.Background(), metav1.ListOptions{LabelSelector: "debug-tool/target=api-1"})
+	if len(copies.Items) != 1 {
+		t.Fatalf("expected one pod copy, got %d", len(copies.Items))
+	}
+	copied := copies.Items[0].Name + "/debugger"
+
+	tests := []struct {
+		name          string
+		allNamespaces bool
+		wantTypes     map[string]string
+	}{
+		{
+			name:          "Current namespace",
+			allNamespaces: false,
+			wantTypes: map[string]string{
+				"debug-123/debugger":        "pod",
+				"api-0/debugger-abcde":      "ephemeral",
+				"debug-api-0-copy/debugger": "copy",
+				copied:                      "copy",
+			},
+		},
+		{
+			name:          "All namespaces",
+			allNamespaces: true,
+			wantTypes: map[string]string{
+				"debug-123/debugger":        "pod",
+				"api-0/debugger-abcde":      "ephemeral",
+				"debug-api-0-copy/debugger": "copy",
+				copied:                      "copy",
+				"debug-456/debugger":        "pod",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd.SetClientset(client)
+			cmd.SetNamespace("default")
+			cmd.SetAllNamespaces(tt.allNamespaces)
+
+			sessions, err := cmd.ListDebugSessions()
+			if err != nil {
+				t.Fatalf("ListDebugSessions() error = %v", err)
+			}
+			if len(sessions) != len(tt.wantTypes) {
+				t.Fatalf("ListDebugSessions() returned %d sessions, want %d: %+v", len(sessions), len(tt.wantTypes), sessions)
+			}
+			for _, s := range sessions {
+				key := s.Pod + "/" + s.Container
+				if want, ok := tt.wantTypes[key]; !ok || s.Type != want {
+					t.Errorf("session %s has type %q, want %q", key, s.Type, want)
+				}
+				if s.Type == "ephemeral" {
+					if s.Target != "api-0" || s.Profile != "restricted" || s.Creator != "alice" || s.Phase != "Running" {
+						t.Errorf("ephemeral session = %+v", s)
+					}
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,90 @@
+package test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/jbuet/kubectl-debug/cmd"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestNodeDebug(t *testing.T) {
+	defer cmd.SetClientset(nil)
+	defer cmd.SetNodeName("")
+	defer cmd.SetProfile("")
+	defer cmd.SetForce(false)
+	defer cmd.SetDryRun("none", "yaml")
+
+	tests := []struct {
+		name    string
+		profile string
+		dryRun  bool
+		wantErr bool
+	}{
+		{name: "Privileged profile", profile: "privileged", wantErr: false},
+		{name: "Restricted profile is rejected", profile: "restricted", wantErr: true},
+		{name: "No profile is rejected", profile: "", wantErr: true},
+		{name: "Dry run without confirmation", profile: "privileged", dryRun: true, wantErr: false},
+		{name: "Dry run with restricted profile is rejected", profile: "restricted", dryRun: true, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := newClientset()
+			cmd.SetClientset(client)
+			cmd.SetNamespace("default")
+			cmd.SetPodName("node/worker-1")
+			cmd.SetNodeName("")
+			cmd.SetProfile(tt.profile)
+			cmd.SetImage("debug:latest")
+			// A dry run creates nothing and is not confirmed
+			cmd.SetForce(!tt.dryRun)
+			if tt.dryRun {
+				cmd.SetDryRun("client", "yaml")
+			} else {
+				cmd.SetDryRun("none", "yaml")
+			}
+
+			_, err := captureStdout(t, cmd.RunDebug)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("RunDebug() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if tt.dryRun {
+				pods, _ := client.CoreV1().Pods("default").List(context.Background(), metav1.ListOptions{})
+				if len(pods.Items) != 0 {
+					t.Errorf("dry run created %d pods", len(pods.Items))
+				}
+				return
+			}
+
+			pods, err := client.CoreV1().Pods("default").List(context.Background(), metav1.ListOptions{})
+			if err != nil || len(pods.Items) != 1 {
+				t.Fatalf("expected one debug pod, got %v (err %v)", len(pods.Items), err)
+			}
+			spec := pods.Items[0].Spec
+			if spec.NodeName != "worker-1" {
+				t.Errorf("NodeName = %q, want worker-1", spec.NodeName)
+			}
+			if !spec.HostPID || !spec.HostNetwork || !spec.HostIPC {
+				t.Errorf("host namespaces not shared: pid=%v net=%v ipc=%v", spec.HostPID, spec.HostNetwork, spec.HostIPC)
+			}
+			if len(spec.Tolerations) != 1 || spec.Tolerations[0].Operator != corev1.TolerationOpExists {
+				t.Errorf("Tolerations = %v, want tolerate all", spec.Tolerations)
+			}
+			if len(spec.Volumes) != 1 || spec.Volumes[0].HostPath == nil || spec.Volumes[0].HostPath.Path != "/" {
+				t.Errorf("Volumes = %v, want host root", spec.Volumes)
+			}
+			mounts := spec.Containers[0].VolumeMounts
+			if len(mounts) != 1 || mounts[0].MountPath != "/host" {
+				t.Errorf("VolumeMounts = %v, want /host", mounts)
+			}
+			if sc := spec.Containers[0].SecurityContext; sc == nil || sc.Privileged == nil || !*sc.Privileged {
+				t.Errorf("debug container is not privileged")
+			}
+		})
+	}
+}
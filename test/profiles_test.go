@@ -0,0 +1,146 @@
+package test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jbuet/kubectl-debug/cmd"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+const clusterProfiles = `profiles:
+- name: netadmin
+  description: network troubleshooting
+  securityContext:
+    capabilities:
+      add: ["NET_ADMIN", "NET_RAW"]
+- name: tracer
+  securityContext:
+    capabilities:
+      add: ["SYS_PTRACE"]
+  allowedImages: ["registry.example.com/*"]
+`
+
+const userProfiles = `profiles:
+- name: tracer
+  description: overridden by the user
+  securityContext:
+    capabilities:
+      add: ["SYS_PTRACE"]
+  appArmorProfile:
+    type: Unconfined
+`
+
+func writeProfilesFile(t *testing.T, content string) string {
+	t.Helper()
+	file := filepath.Join(t.TempDir(), "profiles.yaml")
+	if err := os.WriteFile(file, []byte(content), 0o600); err != nil {
+		t.Fatalf("error writing profiles file: %v", err)
+	}
+	return file
+}
+
+func TestLoadProfiles(t *testing.T) {
+	defer cmd.SetClientset(nil)
+	defer cmd.SetProfileSources("", "")
+	defer cmd.SetProfile("")
+	defer cmd.SetImage("jbuet/debug:latest")
+
+	configMap := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "kubectl-debug-profiles", Namespace: "kube-system"},
+		Data:       map[string]string{"profiles.yaml": clusterProfiles},
+	}
+	cmd.SetClientset(fake.NewSimpleClientset(configMap))
+	cmd.SetProfileSources(writeProfilesFile(t, userProfiles), "kube-system/kubectl-debug-profiles")
+
+	if err := cmd.LoadProfiles(); err != nil {
+		t.Fatalf("LoadProfiles() error = %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		profile string
+		image   string
+		wantErr bool
+	}{
+		{name: "Built-in profile", profile: "restricted", image: "debug:latest"},
+		{name: "Cluster profile", profile: "netadmin", image: "debug:latest"},
+		{name: "User profile overrides allowed images", profile: "tracer", image: "debug:latest"},
+		{name: "Unknown profile", profile: "sysadmin", image: "debug:latest", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd.SetProfile(tt.profile)
+			cmd.SetImage(tt.image)
+			err := cmd.ValidateProfileSelection()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ValidateProfileSelection() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	containerContext, podContext := cmd.GetSecurityContextForProfile("netadmin")
+	if containerContext.Capabilities == nil || len(containerContext.Capabilities.Add) != 2 {
+		t.Errorf("netadmin capabilities = %v", containerContext.Capabilities)
+	}
+	if podContext.SeccompProfile == nil || podContext.SeccompProfile.Type != corev1.SeccompProfileTypeRuntimeDefault {
+		t.Errorf("netadmin pod seccomp = %v, want RuntimeDefault", podContext.SeccompProfile)
+	}
+
+	containerContext, _ = cmd.GetSecurityContextForProfile("tracer")
+	if containerContext.AppArmorProfile == nil || containerContext.AppArmorProfile.Type != corev1.AppArmorProfileTypeUnconfined {
+		t.Errorf("tracer apparmor = %v, want Unconfined", containerContext.AppArmorProfile)
+	}
+}
+
+func TestProfileAllowedImages(t *testing.T) {
+	defer cmd.SetClientset(nil)
+	defer cmd.SetProfileSources("", "")
+	defer cmd.SetProfile("")
+	defer cmd.SetImage("jbuet/debug:latest")
+
+	cmd.SetClientset(fake.NewSimpleClientset())
+	cmd.SetProfileSources(writeProfilesFile(t, clusterProfiles), "")
+	if err := cmd.LoadProfiles(); err != nil {
+		t.Fatalf("LoadProfiles() error = %v", err)
+	}
+
+	cmd.SetProfile("tracer")
+	cmd.SetImage("registry.example.com/debug")
+	if err := cmd.ValidateProfileSelection(); err != nil {
+		t.Errorf("allowed image rejected: %v", err)
+	}
+	cmd.SetImage("docker.io/debug")
+	if err := cmd.ValidateProfileSelection(); err == nil {
+		t.Errorf("image outside allowedImages was accepted")
+	}
+}
+
+func TestInvalidProfiles(t *testing.T) {
+	defer cmd.SetClientset(nil)
+	defer cmd.SetProfileSources("", "")
+
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{name: "Redefines built-in", content: "profiles:\n- name: privileged\n"},
+		{name: "Invalid name", content: "profiles:\n- name: Net_Admin\n"},
+		{name: "Duplicate", content: "profiles:\n- name: a\n- name: a\n"},
+		{name: "Localhost seccomp without profile", content: "profiles:\n- name: a\n  seccompProfile:\n    type: Localhost\n"},
+		{name: "Bad image pattern", content: "profiles:\n- name: a\n  allowedImages: [\"[\"]\n"},
+		{name: "Unknown field", content: "profiles:\n- name: a\n  capabilities: [NET_ADMIN]\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd.SetClientset(fake.NewSimpleClientset())
+			cmd.SetProfileSources(writeProfilesFile(t, tt.content), "")
+			if err := cmd.LoadProfiles(); err == nil {
+				t.Errorf("LoadProfiles() accepted invalid profiles")
+			}
+		})
+	}
+}
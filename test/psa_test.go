@@ -0,0 +1,138 @@
+package test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/jbuet/kubectl-debug/cmd"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func newPSANamespace(level string) *corev1.Namespace {
+	return &corev1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   "default",
+			Labels: map[string]string{"pod-security.kubernetes.io/enforce": level},
+		},
+	}
+}
+
+func TestCheckPodSecurity(t *testing.T) {
+	restrictedPod := func() *corev1.Pod {
+		pod := newTargetPod("test-pod", "default")
+		pod.Spec.SecurityContext = &corev1.PodSecurityContext{
+			RunAsNonRoot:   ptr(true),
+			SeccompProfile: &corev1.SeccompProfile{Type: corev1.SeccompProfileTypeRuntimeDefault},
+		}
+		pod.Spec.Containers[0].SecurityContext = &corev1.SecurityContext{
+			AllowPrivilegeEscalation: ptr(false),
+			Capabilities:             &corev1.Capabilities{Drop: []corev1.Capability{"ALL"}},
+		}
+		return pod
+	}
+
+	privileged := restrictedPod()
+	privileged.Spec.Containers[0].SecurityContext.Privileged = ptr(true)
+
+	hostPID := restrictedPod()
+	hostPID.Spec.HostPID = true
+
+	netAdmin := restrictedPod()
+	netAdmin.Spec.Containers[0].SecurityContext.Capabilities.Add = []corev1.Capability{"NET_ADMIN"}
+
+	root := restrictedPod()
+	root.Spec.Containers[0].SecurityContext.RunAsUser = ptr(int64(0))
+
+	tests := []struct {
+		name  string
+		pod   *corev1.Pod
+		level string
+		want  []string
+	}{
+		{name: "Restricted pod", pod: restrictedPod(), level: "restricted"},
+		{name: "Anything is privileged", pod: privileged, level: "privileged"},
+		{name: "Privileged container", pod: privileged, level: "baseline", want: []string{"spec.containers[0].securityContext.privileged"}},
+		{name: "Host PID", pod: hostPID, level: "baseline", want: []string{"spec.hostPID"}},
+		{name: "Added capability", pod: netAdmin, level: "baseline", want: []string{"spec.containers[0].securityContext.capabilities.add: capability NET_ADMIN"}},
+		{name: "Root is baseline", pod: root, level: "baseline"},
+		{name: "Root is not restricted", pod: root, level: "restricted", want: []string{"spec.containers[0].securityContext.runAsUser"}},
+		{
+			name:  "Target container without security context",
+			pod:   newTargetPod("test-pod", "default"),
+			level: "restricted",
+			want: []string{
+				"spec.containers[0].securityContext.allowPrivilegeEscalation",
+				"spec.containers[0].securityContext.runAsNonRoot",
+				"spec.containers[0].securityContext.seccompProfile.type",
+				"spec.containers[0].securityContext.capabilities.drop",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := cmd.CheckPodSecurity(tt.pod, tt.level)
+			if len(got) != len(tt.want) {
+				t.Fatalf("CheckPodSecurity() = %v, want %d violations", got, len(tt.want))
+			}
+			for i, want := range tt.want {
+				if !strings.HasPrefix(got[i], want) {
+					t.Errorf("violation %d = %q, want prefix %q", i, got[i], want)
+				}
+			}
+		})
+	}
+}
+
+func TestPodSecurityPreflight(t *testing.T) {
+	defer cmd.SetClientset(nil)
+	defer cmd.SetProfile("")
+	defer cmd.SetForce(false)
+	defer cmd.SetNodeName("")
+
+	tests := []struct {
+		name        string
+		level       string
+		profile     string
+		podName     string
+		wantProfile string
+		wantErr     bool
+	}{
+		{name: "Allowed profile is kept", level: "baseline", profile: "baseline", wantProfile: "baseline"},
+		{name: "Privileged in baseline namespace", level: "baseline", profile: "privileged", wantProfile: "general"},
+		{name: "General in restricted namespace", level: "restricted", profile: "", wantProfile: "restricted"},
+		{name: "Node debugging in baseline namespace", level: "baseline", profile: "privileged", podName: "node/worker-1", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := newClientset(newPSANamespace(tt.level))
+			cmd.SetClientset(client)
+			cmd.SetNamespace("default")
+			cmd.SetPodName(tt.podName)
+			cmd.SetNodeName("")
+			cmd.SetProfile(tt.profile)
+			cmd.SetForce(true)
+
+			err := cmd.RunDebug()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("RunDebug() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			pods, _ := client.CoreV1().Pods("default").List(context.Background(), metav1.ListOptions{})
+			if tt.wantErr {
+				if len(pods.Items) != 0 {
+					t.Errorf("debug pod created despite Pod Security violations")
+				}
+				return
+			}
+			if got := cmd.GetProfile(); got != tt.wantProfile {
+				t.Errorf("profile = %q, want %q", got, tt.wantProfile)
+			}
+			if len(pods.Items) != 1 || len(cmd.CheckPodSecurity(&pods.Items[0], tt.level)) != 0 {
+				t.Errorf("created pods do not satisfy %s: %v", tt.level, pods.Items)
+			}
+		})
+	}
+}
@@ -0,0 +1,123 @@
+package test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/jbuet/kubectl-debug/cmd"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// denyAccess makes the access reviews of the given "verb resource" pairs fail
+func denyAccess(client *fake.Clientset, denied ...string) {
+	client.PrependReactor("create", "selfsubjectaccessreviews", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		review := action.(k8stesting.CreateAction).GetObject().(*authorizationv1.SelfSubjectAccessReview).DeepCopy()
+		attrs := review.Spec.ResourceAttributes
+		resource := attrs.Resource
+		if attrs.Subresource != "" {
+			resource += "/" + attrs.Subresource
+		}
+		review.Status.Allowed = true
+		for _, d := range denied {
+			if d == attrs.Verb+" "+resource {
+				review.Status.Allowed = false
+				review.Status.Reason = "no RBAC policy matched"
+			}
+		}
+		return true, review, nil
+	})
+}
+
+func TestRequiredAccess(t *testing.T) {
+	defer cmd.SetSession(false, false, false)
+	defer cmd.SetCopyPod(false)
+	defer cmd.SetPodName("")
+	defer cmd.SetTTL(0)
+
+	tests := []struct {
+		name    string
+		podName string
+		copyPod bool
+		session bool
+		rm      bool
+		want    []string
+	}{
+		{name: "Standalone pod", want: []string{"create pods"}},
+		{name: "Standalone session", session: true, rm: true, want: []string{"create pods", "create pods/attach", "delete pods"}},
+		{name: "Pod copy", podName: "test-pod", copyPod: true, session: true, want: []string{"get pods", "list pods", "create pods", "create pods/attach", "create pods/exec"}},
+		{name: "Pod copy without session", podName: "test-pod", copyPod: true, want: []string{"get pods", "list pods", "create pods"}},
+		{name: "Ephemeral container", podName: "test-pod", want: []string{"get pods", "patch pods/ephemeralcontainers"}},
+		{
+			name:    "Ephemeral session with --rm",
+			podName: "test-pod",
+			session: true,
+			rm:      true,
+			want:    []string{"get pods", "patch pods/ephemeralcontainers", "create pods/attach", "create pods/exec"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd.SetPodName(tt.podName)
+			cmd.SetCopyPod(tt.copyPod)
+			cmd.SetSession(tt.session, tt.session, tt.rm)
+			cmd.SetTTL(0)
+
+			if got := cmd.RequiredAccess(); !stringSliceEqual(got, tt.want) {
+				t.Errorf("RequiredAccess() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRBACPreflight(t *testing.T) {
+	defer cmd.SetClientset(nil)
+	defer cmd.SetCopyPod(false)
+
+	tests := []struct {
+		name    string
+		podName string
+		denied  []string
+		wantErr string
+	}{
+		{name: "All allowed", podName: "test-pod"},
+		{name: "Ephemeral containers denied", podName: "test-pod", denied: []string{"patch pods/ephemeralcontainers"}, wantErr: "1 required permission(s) missing"},
+		{name: "Standalone pod denied", denied: []string{"create pods", "patch pods/ephemeralcontainers"}, wantErr: "1 required permission(s) missing"},
+		{name: "Unrelated permission denied", denied: []string{"create pods"}, podName: "test-pod"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := newClientset(newTargetPod("test-pod", "default"))
+			denyAccess(client, tt.denied...)
+			cmd.SetClientset(client)
+			cmd.SetNamespace("default")
+			cmd.SetPodName(tt.podName)
+			cmd.SetContainer("")
+			cmd.SetCopyPod(false)
+			cmd.SetProfile("")
+
+			err := cmd.RunDebug()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("RunDebug() error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("RunDebug() error = %v, want %q", err, tt.wantErr)
+			}
+
+			// Nothing may be created or changed once a permission is missing
+			pods, _ := client.CoreV1().Pods("default").List(context.Background(), metav1.ListOptions{})
+			if len(pods.Items) != 1 || len(pods.Items[0].Spec.EphemeralContainers) != 0 {
+				t.Errorf("debug session started despite missing permissions: %v", pods.Items)
+			}
+		})
+	}
+}
@@ -0,0 +1,334 @@
+package test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/jbuet/kubectl-debug/cmd"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestValidateResources(t *testing.T) {
+	defer cmd.SetResources("100m", "128Mi", "128Mi")
+
+	tests := []struct {
+		name          string
+		cpuRequest    string
+		memoryRequest string
+		memoryLimit   string
+		wantErr       bool
+	}{
+		{name: "Defaults", cpuRequest: "100m", memoryRequest: "128Mi", memoryLimit: "128Mi"},
+		{name: "Unset values", cpuRequest: "", memoryRequest: "", memoryLimit: ""},
+		{name: "Invalid unit", cpuRequest: "100m", memoryRequest: "128Mi", memoryLimit: "128mb", wantErr: true},
+		{name: "Negative", cpuRequest: "-1", memoryRequest: "128Mi", memoryLimit: "128Mi", wantErr: true},
+		{name: "Request above limit", cpuRequest: "100m", memoryRequest: "256Mi", memoryLimit: "128Mi", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd.SetResources(tt.cpuRequest, tt.memoryRequest, tt.memoryLimit)
+			err := cmd.ValidateResources()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ValidateResources() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func newLimitRange(item corev1.LimitRangeItem) *corev1.LimitRange {
+	return &corev1.LimitRange{
+		ObjectMeta: metav1.ObjectMeta{Name: "limits", Namespace: "default"},
+		Spec:       corev1.LimitRangeSpec{Limits: []corev1.LimitRangeItem{item}},
+	}
+}
+
+func newResourceQuota(hard, used corev1.ResourceList) *corev1.ResourceQuota {
+	return &corev1.ResourceQuota{
+		ObjectMeta: metav1.ObjectMeta{Name: "quota", Namespace: "default"},
+		Spec:       corev1.ResourceQuotaSpec{Hard: hard},
+		Status:     corev1.ResourceQuotaStatus{Hard: hard, Used: used},
+	}
+}
+
+func TestNamespaceResourceChecks(t *testing.T) {
+	defer cmd.SetClientset(nil)
+	defer cmd.SetCopyPod(false)
+
+	tests := []struct {
+		name    string
+		objects []runtime.Object
+		copyPod bool
+		wantErr bool
+	}{
+		{name: "No limits", objects: nil},
+		{
+			name: "Within LimitRange",
+			objects: []runtime.Object{newLimitRange(corev1.LimitRangeItem{
+				Type: corev1.LimitTypeContainer,
+				Max:  corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("1Gi")},
+			})},
+		},
+		{
+			name: "Above LimitRange maximum",
+			objects: []runtime.Object{newLimitRange(corev1.LimitRangeItem{
+				Type: corev1.LimitTypeContainer,
+				Max:  corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("64Mi")},
+			})},
+			wantErr: true,
+		},
+		{
+			name: "LimitRange requires a CPU limit",
+			objects: []runtime.Object{newLimitRange(corev1.LimitRangeItem{
+				Type: corev1.LimitTypeContainer,
+				Max:  corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("1")},
+			})},
+			wantErr: true,
+		},
+		{
+			name: "Default CPU limit below request",
+			objects: []runtime.Object{newLimitRange(corev1.LimitRangeItem{
+				Type:    corev1.LimitTypeContainer,
+				Default: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("50m")},
+			})},
+			wantErr: true,
+		},
+		{
+			name: "Quota with room",
+			objects: []runtime.Object{newResourceQuota(
+				corev1.ResourceList{corev1.ResourceRequestsMemory: resource.MustParse("1Gi")},
+				corev1.ResourceList{corev1.ResourceRequestsMemory: resource.MustParse("512Mi")},
+			)},
+		},
+		{
+			name: "Quota exhausted",
+			objects: []runtime.Object{newResourceQuota(
+				corev1.ResourceList{corev1.ResourcePods: resource.MustParse("2")},
+				corev1.ResourceList{corev1.ResourcePods: resource.MustParse("2")},
+			)},
+			wantErr: true,
+		},
+		{
+			name: "Quota requires a CPU limit",
+			objects: []runtime.Object{newResourceQuota(
+				corev1.ResourceList{corev1.ResourceLimitsCPU: resource.MustParse("4")},
+				corev1.ResourceList{},
+			)},
+			wantErr: true,
+		},
+		{
+			// The debugger sets a memory limit, the copied target does not
+			name: "Copy with a target lacking a quota limit",
+			objects: []runtime.Object{newResourceQuota(
+				corev1.ResourceList{corev1.ResourceLimitsMemory: resource.MustParse("4Gi")},
+				corev1.ResourceList{},
+			)},
+			copyPod: true,
+			wantErr: true,
+		},
+		{
+			name: "Copy with a defaulted target quota limit",
+			objects: []runtime.Object{
+				newLimitRange(corev1.LimitRangeItem{
+					Type:    corev1.LimitTypeContainer,
+					Default: corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("256Mi")},
+				}),
+				newResourceQuota(
+					corev1.ResourceList{corev1.ResourceLimitsMemory: resource.MustParse("4Gi")},
+					corev1.ResourceList{},
+				),
+			},
+			copyPod: true,
+		},
+		{
+			// The target container gets the default limit too, which the
+			// quota has no room for next to the debugger's
+			name: "Copy with defaulted target limits above quota",
+			objects: []runtime.Object{
+				newLimitRange(corev1.LimitRangeItem{
+					Type:    corev1.LimitTypeContainer,
+					Default: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("500m")},
+				}),
+				newResourceQuota(
+					corev1.ResourceList{corev1.ResourceLimitsCPU: resource.MustParse("800m")},
+					corev1.ResourceList{},
+				),
+			},
+			copyPod: true,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			objects, podName := tt.objects, ""
+			if tt.copyPod {
+				objects, podName = append(objects, newTargetPod("test-pod", "default")), "test-pod"
+			}
+			client := newClientset(objects...)
+			cmd.SetClientset(client)
+			cmd.SetNamespace("default")
+			cmd.SetPodName(podName)
+			cmd.SetContainer("")
+			cmd.SetCopyPod(tt.copyPod)
+			cmd.SetProfile("")
+
+			err := cmd.RunDebug()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("RunDebug() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			pods, _ := client.CoreV1().Pods("default").List(context.Background(), metav1.ListOptions{
+				LabelSelector: "debug-tool/type=debug-pod",
+			})
+			if tt.wantErr && len(pods.Items) != 0 {
+				t.Errorf("debug pod created despite failing resource checks")
+			}
+		})
+	}
+}
+
+func TestQoS(t *testing.T) {
+	defer cmd.SetResources("100m", "128Mi", "128Mi")
+	defer cmd.SetExtraResources("", "", "", "")
+
+	tests := []struct {
+		name         string
+		cpuLimit     string
+		qos          string
+		wantRequests map[corev1.ResourceName]string
+		wantLimits   map[corev1.ResourceName]string
+		wantErr      bool
+	}{
+		{
+			name:         "Flags as given",
+			wantRequests: map[corev1.ResourceName]string{corev1.ResourceCPU: "100m", corev1.ResourceMemory: "128Mi", corev1.ResourceEphemeralStorage: "1Gi"},
+			wantLimits:   map[corev1.ResourceName]string{corev1.ResourceMemory: "128Mi", corev1.ResourceEphemeralStorage: "2Gi"},
+		},
+		{
+			name:         "Guaranteed",
+			cpuLimit:     "500m",
+			qos:          "guaranteed",
+			wantRequests: map[corev1.ResourceName]string{corev1.ResourceCPU: "500m", corev1.ResourceMemory: "128Mi", corev1.ResourceEphemeralStorage: "1Gi"},
+			wantLimits:   map[corev1.ResourceName]string{corev1.ResourceCPU: "500m", corev1.ResourceMemory: "128Mi", corev1.ResourceEphemeralStorage: "2Gi"},
+		},
+		{
+			name:         "Burstable drops matching limits",
+			cpuLimit:     "100m",
+			qos:          "burstable",
+			wantRequests: map[corev1.ResourceName]string{corev1.ResourceCPU: "100m", corev1.ResourceMemory: "128Mi", corev1.ResourceEphemeralStorage: "1Gi"},
+			wantLimits:   map[corev1.ResourceName]string{corev1.ResourceEphemeralStorage: "2Gi"},
+		},
+		{
+			name:         "Best effort keeps ephemeral storage",
+			qos:          "besteffort",
+			wantRequests: map[corev1.ResourceName]string{corev1.ResourceEphemeralStorage: "1Gi"},
+			wantLimits:   map[corev1.ResourceName]string{corev1.ResourceEphemeralStorage: "2Gi"},
+		},
+		{name: "Unknown class", qos: "platinum", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd.SetResources("100m", "128Mi", "128Mi")
+			cmd.SetExtraResources(tt.cpuLimit, "1Gi", "2Gi", tt.qos)
+
+			got, err := cmd.DebugResources()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("DebugResources() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			checkResourceList(t, "requests", got.Requests, tt.wantRequests)
+			checkResourceList(t, "limits", got.Limits, tt.wantLimits)
+		})
+	}
+}
+
+func checkResourceList(t *testing.T, what string, got corev1.ResourceList, want map[corev1.ResourceName]string) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Errorf("%s = %v, want %v", what, got, want)
+		return
+	}
+	for name, value := range want {
+		if q, ok := got[name]; !ok || q.Cmp(resource.MustParse(value)) != 0 {
+			t.Errorf("%s[%s] = %v, want %s", what, name, got[name], value)
+		}
+	}
+}
+
+func TestEphemeralContainerResources(t *testing.T) {
+	defer cmd.SetClientset(nil)
+	defer cmd.SetExtraResources("", "", "", "")
+
+	client := newClientset(newTargetPod("test-pod", "default"))
+	cmd.SetClientset(client)
+	cmd.SetNamespace("default")
+	cmd.SetPodName("test-pod")
+	cmd.SetContainer("")
+	cmd.SetCopyPod(false)
+	cmd.SetImage("debug:latest")
+	cmd.SetExtraResources("500m", "", "", "guaranteed")
+
+	if err := cmd.RunDebug(); err != nil {
+		t.Fatalf("RunDebug() error = %v", err)
+	}
+
+	pod, err := client.CoreV1().Pods("default").Get(context.Background(), "test-pod", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("error getting target pod: %v", err)
+	}
+	if len(pod.Spec.EphemeralContainers) != 1 {
+		t.Fatalf("expected one ephemeral container, got %d", len(pod.Spec.EphemeralContainers))
+	}
+	ec := pod.Spec.EphemeralContainers[0]
+	if ec.TargetContainerName != "nginx" || ec.Image != "debug:latest" {
+		t.Errorf("ephemeral container target = %q, image = %q", ec.TargetContainerName, ec.Image)
+	}
+	cpu := ec.Resources.Limits[corev1.ResourceCPU]
+	if cpu.String() != "500m" {
+		t.Errorf("ephemeral container CPU limit = %s, want 500m", cpu.String())
+	}
+}
+
+func TestEphemeralContainerResourcesRejected(t *testing.T) {
+	defer cmd.SetClientset(nil)
+
+	client := newClientset(newTargetPod("test-pod", "default"))
+	rejected := 0
+	client.PrependReactor("patch", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		patch := action.(k8stesting.PatchAction)
+		if patch.GetSubresource() != "ephemeralcontainers" || !strings.Contains(string(patch.GetPatch()), `"resources":{"limits"`) {
+			return false, nil, nil
+		}
+		rejected++
+		return true, nil, apierrors.NewInvalid(schema.GroupKind{Kind: "Pod"}, "test-pod", field.ErrorList{
+			field.Forbidden(field.NewPath("spec", "ephemeralContainers").Index(0).Child("resources"), "cannot be set for an Ephemeral Container"),
+		})
+	})
+	cmd.SetClientset(client)
+	cmd.SetNamespace("default")
+	cmd.SetPodName("test-pod")
+	cmd.SetContainer("")
+	cmd.SetCopyPod(false)
+
+	if err := cmd.RunDebug(); err != nil {
+		t.Fatalf("RunDebug() error = %v", err)
+	}
+	if rejected != 1 {
+		t.Errorf("expected one rejected patch, got %d", rejected)
+	}
+
+	pod, _ := client.CoreV1().Pods("default").Get(context.Background(), "test-pod", metav1.GetOptions{})
+	if len(pod.Spec.EphemeralContainers) != 1 || len(pod.Spec.EphemeralContainers[0].Resources.Limits) != 0 {
+		t.Errorf("ephemeral containers = %+v, want one without resources", pod.Spec.EphemeralContainers)
+	}
+}
@@ -0,0 +1,154 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jbuet/kubectl-debug/cmd"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// runningPods makes every container of the pods returned by the fake
+// clientset report as running, ephemeral containers included
+func runningPods(client *fake.Clientset) {
+	client.PrependReactor("get", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		get := action.(k8stesting.GetAction)
+		obj, err := client.Tracker().Get(corev1.SchemeGroupVersion.WithResource("pods"), get.GetNamespace(), get.GetName())
+		if err != nil {
+			return true, nil, err
+		}
+		pod := obj.(*corev1.Pod).DeepCopy()
+		pod.Status.Phase = corev1.PodRunning
+		pod.Status.ContainerStatuses = nil
+		for _, c := range pod.Spec.Containers {
+			pod.Status.ContainerStatuses = append(pod.Status.ContainerStatuses, corev1.ContainerStatus{
+				Name:  c.Name,
+				State: corev1.ContainerState{Running: &corev1.ContainerStateRunning{StartedAt: metav1.Now()}},
+			})
+		}
+		pod.Status.EphemeralContainerStatuses = nil
+		for _, ec := range pod.Spec.EphemeralContainers {
+			pod.Status.EphemeralContainerStatuses = append(pod.Status.EphemeralContainerStatuses, corev1.ContainerStatus{
+				Name:  ec.Name,
+				State: corev1.ContainerState{Running: &corev1.ContainerStateRunning{StartedAt: metav1.Now()}},
+			})
+		}
+		return true, pod, nil
+	})
+}
+
+func TestRunCommand(t *testing.T) {
+	defer cmd.SetClientset(nil)
+	defer cmd.SetRunCommand(nil)
+	defer cmd.SetSession(false, false, false)
+	defer cmd.SetWaitTimeout(30 * time.Second)
+	cmd.SetWaitTimeout(time.Second)
+
+	tests := []struct {
+		name          string
+		podName       string
+		command       []string
+		rm            bool
+		wantCode      int
+		wantPods      int
+		wantContainer string
+	}{
+		{name: "Standalone pod", command: []string{"exit", "0"}, wantPods: 1, wantContainer: "debugger"},
+		{name: "Standalone pod removed after failure", command: []string{"exit", "3"}, rm: true, wantCode: 3, wantPods: 0, wantContainer: "debugger"},
+		{name: "Ephemeral container", podName: "test-pod", command: []string{"exit", "7"}, rm: true, wantCode: 7, wantPods: 1, wantContainer: "debugger-"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sessions := useFakeSessions(t)
+
+			client := newClientset(newTargetPod("test-pod", "default"))
+			runningPods(client)
+			if tt.podName == "" {
+				// The target pod is not part of a standalone session
+				client.Tracker().Delete(corev1.SchemeGroupVersion.WithResource("pods"), "default", "test-pod")
+			}
+			cmd.SetClientset(client)
+			cmd.SetNamespace("default")
+			cmd.SetPodName(tt.podName)
+			cmd.SetContainer("")
+			cmd.SetCopyPod(false)
+			cmd.SetProfile("")
+			cmd.SetSession(false, false, tt.rm)
+			cmd.SetRunCommand(tt.command)
+
+			out, err := captureStdout(t, cmd.RunDebug)
+
+			var exitErr *cmd.CommandExitError
+			switch {
+			case tt.wantCode == 0 && err != nil:
+				t.Fatalf("RunDebug() error = %v", err)
+			case tt.wantCode != 0 && (!errors.As(err, &exitErr) || exitErr.Code != tt.wantCode):
+				t.Fatalf("RunDebug() error = %v, want exit code %d", err, tt.wantCode)
+			}
+			if out != "remote stdout" {
+				t.Errorf("stdout = %q, want only the remote stdout", out)
+			}
+
+			recorded := sessions.recorded()
+			if len(recorded) == 0 || recorded[0].Subresource != "exec" || !strings.HasPrefix(recorded[0].Container, tt.wantContainer) || !stringSliceEqual(recorded[0].Command, tt.command) {
+				t.Errorf("sessions = %+v, want %v run in %s", recorded, tt.command, tt.wantContainer)
+			}
+
+			pods, _ := client.CoreV1().Pods("default").List(context.Background(), metav1.ListOptions{})
+			if len(pods.Items) != tt.wantPods {
+				t.Errorf("%d pods left, want %d", len(pods.Items), tt.wantPods)
+			}
+			for _, pod := range pods.Items {
+				containers := pod.Spec.Containers
+				if tt.podName != "" {
+					containers = nil
+					for _, ec := range pod.Spec.EphemeralContainers {
+						containers = append(containers, corev1.Container{Name: ec.Name, Command: ec.Command})
+					}
+					// --rm stops the ephemeral container after the command
+					if tt.rm && (len(recorded) != 2 || !strings.Contains(strings.Join(recorded[1].Command, " "), "DEBUG_TOOL_SESSION")) {
+						t.Errorf("sessions = %+v, want the debug container stopped", recorded)
+					}
+				}
+				if len(containers) == 0 || strings.Join(containers[len(containers)-1].Command, " ") != "sleep infinity" {
+					t.Errorf("debug container command = %v, want sleep infinity", containers)
+				}
+			}
+		})
+	}
+}
+
+func TestRunCommandCopyDryRun(t *testing.T) {
+	defer cmd.SetClientset(nil)
+	defer cmd.SetRunCommand(nil)
+	defer cmd.SetCopyPod(false)
+	defer cmd.SetDryRun("none", "yaml")
+
+	cmd.SetClientset(newClientset(newTargetPod("test-pod", "default")))
+	cmd.SetNamespace("default")
+	cmd.SetPodName("test-pod")
+	cmd.SetContainer("")
+	cmd.SetCopyPod(true)
+	cmd.SetProfile("")
+	cmd.SetSession(false, false, false)
+	cmd.SetRunCommand([]string{"curl", "-sS", "localhost:8080/healthz"})
+	cmd.SetDryRun("client", "yaml")
+
+	out, err := captureStdout(t, cmd.RunDebug)
+	if err != nil {
+		t.Fatalf("RunDebug() error = %v", err)
+	}
+	for _, want := range []string{"name: debugger", "- sleep", "- infinity", "- exec", "- localhost:8080/healthz"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("dry-run output missing %q:\n%s", want, out)
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jbuet/kubectl-debug/cmd"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// newSelectablePods returns three app=api pods with different ages and restart counts
+func newSelectablePods() []corev1.Pod {
+	pod := func(name string, age time.Duration, restarts int32) corev1.Pod {
+		p := newTargetPod(name, "default")
+		p.Labels = map[string]string{"app": "api"}
+		p.CreationTimestamp = metav1.NewTime(time.Now().Add(-age))
+		p.Status.ContainerStatuses = []corev1.ContainerStatus{{Name: "nginx", RestartCount: restarts}}
+		return *p
+	}
+	return []corev1.Pod{
+		pod("api-a", 3*time.Hour, 1),
+		pod("api-b", 1*time.Hour, 9),
+		pod("api-c", 2*time.Hour, 0),
+	}
+}
+
+func TestPickPod(t *testing.T) {
+	tests := []struct {
+		name     string
+		strategy string
+		wantPod  string
+		wantErr  bool
+	}{
+		{name: "First", strategy: "first", wantPod: "api-a"},
+		{name: "Newest", strategy: "newest", wantPod: "api-b"},
+		{name: "Most restarts", strategy: "most-restarts", wantPod: "api-b"},
+		{name: "Invalid strategy", strategy: "oldest", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := cmd.PickPod(newSelectablePods(), tt.strategy)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("PickPod() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && got.Name != tt.wantPod {
+				t.Errorf("PickPod() = %v, want %v", got.Name, tt.wantPod)
+			}
+		})
+	}
+
+	got, err := cmd.PickPod(newSelectablePods(), "random")
+	if err != nil || got == nil {
+		t.Errorf("PickPod(random) = %v, %v", got, err)
+	}
+}
+
+func TestSelectTargetPod(t *testing.T) {
+	defer cmd.SetClientset(nil)
+	defer cmd.SetSelector("")
+	defer cmd.SetPick("")
+
+	var objects []runtime.Object
+	for _, pod := range newSelectablePods() {
+		objects = append(objects, pod.DeepCopy())
+	}
+	debugPod := newDebugPod("debug-api", "default", "api-a")
+	debugPod.Labels["app"] = "api"
+	solo := newTargetPod("solo", "default")
+	solo.Labels = map[string]string{"app": "solo"}
+	objects = append(objects, debugPod, solo)
+
+	tests := []struct {
+		name     string
+		selector string
+		pick     string
+		wantPod  string
+		wantErr  bool
+	}{
+		{name: "Single match does not prompt", selector: "app=solo", pick: "", wantPod: "solo"},
+		{name: "Pick newest", selector: "app=api", pick: "newest", wantPod: "api-b"},
+		{name: "Pick first ignores debug pods", selector: "app=api", pick: "first", wantPod: "api-a"},
+		{name: "No match", selector: "app=missing", pick: "first", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd.SetNamespace("default")
+			cmd.SetPodName("")
+			cmd.SetSelector(tt.selector)
+			cmd.SetPick(tt.pick)
+			cmd.SetClientset(fake.NewSimpleClientset(objects...))
+
+			got, err := cmd.SelectTargetPod()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("SelectTargetPod() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && got != tt.wantPod {
+				t.Errorf("SelectTargetPod() = %v, want %v", got, tt.wantPod)
+			}
+		})
+	}
+}
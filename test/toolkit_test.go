@@ -0,0 +1,177 @@
+package test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/jbuet/kubectl-debug/cmd"
+	"github.com/jbuet/kubectl-debug/debug"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// newRegistry serves multi-platform images whose config has the given
+// container.run.as.root label, behind anonymous token authentication
+func newRegistry(t *testing.T, runAsRoot map[string]string) string {
+	t.Helper()
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/token" {
+			json.NewEncoder(w).Encode(map[string]string{"token": "anonymous"})
+			return
+		}
+		if r.Header.Get("Authorization") != "Bearer anonymous" {
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="%s/token",service="test"`, server.URL))
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		path := strings.TrimPrefix(r.URL.Path, "/v2/debug/")
+		switch {
+		case path == "manifests/nested" || path == "manifests/sha256:nested":
+			// An index of itself, which is never resolved to a manifest
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"manifests": []map[string]interface{}{
+					{"digest": "sha256:nested", "platform": map[string]string{"os": "linux", "architecture": "amd64"}},
+				},
+			})
+		case strings.HasPrefix(path, "manifests/sha256:manifest-"):
+			tag := strings.TrimPrefix(path, "manifests/sha256:manifest-")
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"config": map[string]string{"digest": "sha256:config-" + tag},
+			})
+		case strings.HasPrefix(path, "manifests/"):
+			tag := strings.TrimPrefix(path, "manifests/")
+			if _, ok := runAsRoot[tag]; !ok {
+				http.NotFound(w, r)
+				return
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"manifests": []map[string]interface{}{
+					{"digest": "sha256:windows", "platform": map[string]string{"os": "windows", "architecture": "amd64"}},
+					{"digest": "sha256:manifest-" + tag, "platform": map[string]string{"os": "linux", "architecture": "amd64"}},
+				},
+			})
+		case strings.HasPrefix(path, "blobs/sha256:config-"):
+			tag := strings.TrimPrefix(path, "blobs/sha256:config-")
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"config": map[string]interface{}{"Labels": map[string]string{"container.run.as.root": runAsRoot[tag]}},
+			})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return strings.TrimPrefix(server.URL, "http://")
+}
+
+func TestToolkit(t *testing.T) {
+	defer cmd.SetClientset(nil)
+	defer cmd.SetProfile("")
+	defer cmd.SetToolkit("", nil)
+	defer cmd.SetImage("jbuet/debug:latest")
+
+	registry := newRegistry(t, map[string]string{"tools": "false", "tools-root": "true"})
+	nonroot, root := registry+"/debug:tools", registry+"/debug:tools-root"
+	toolkits := map[string]debug.Toolkit{
+		// The root variant is listed first so the label decides
+		"tools":       {Images: []string{root, nonroot}, Command: []string{"bash", "-l"}},
+		"restricted":  {Images: []string{root, nonroot}, Profile: "restricted"},
+		"unreachable": {Images: []string{"127.0.0.1:1/debug:tools-root", "127.0.0.1:1/debug:tools"}},
+		"nested":      {Images: []string{registry + "/debug:nested", nonroot}},
+	}
+
+	tests := []struct {
+		name        string
+		toolkit     string
+		profile     string
+		wantImage   string
+		wantProfile string
+		wantCommand []string
+		wantErr     string
+	}{
+		{name: "Root profile", toolkit: "tools", profile: "privileged", wantImage: root, wantProfile: "privileged", wantCommand: []string{"bash", "-l"}},
+		{name: "Non-root profile", toolkit: "tools", profile: "restricted", wantImage: nonroot, wantProfile: "restricted", wantCommand: []string{"bash", "-l"}},
+		{name: "Toolkit profile", toolkit: "restricted", wantImage: nonroot, wantProfile: "restricted"},
+		{name: "Selected profile wins", toolkit: "restricted", profile: "baseline", wantImage: root, wantProfile: "baseline"},
+		{name: "Unreadable labels", toolkit: "unreachable", profile: "restricted", wantImage: "127.0.0.1:1/debug:tools", wantProfile: "restricted"},
+		{name: "Unreadable labels as root", toolkit: "unreachable", profile: "privileged", wantImage: "127.0.0.1:1/debug:tools-root", wantProfile: "privileged"},
+		{name: "Nested indexes", toolkit: "nested", profile: "restricted", wantImage: nonroot, wantProfile: "restricted"},
+		{name: "Unknown toolkit", toolkit: "rust", wantErr: `invalid toolkit "rust"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := newClientset(newTargetPod("test-pod", "default"))
+			cmd.SetClientset(client)
+			cmd.SetNamespace("default")
+			cmd.SetPodName("test-pod")
+			cmd.SetContainer("")
+			cmd.SetCopyPod(false)
+			cmd.SetProfile(tt.profile)
+			cmd.SetToolkit(tt.toolkit, toolkits)
+
+			err := cmd.RunDebug()
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("RunDebug() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("RunDebug() error = %v", err)
+			}
+
+			if got := cmd.GetProfile(); got != tt.wantProfile {
+				t.Errorf("profile = %q, want %q", got, tt.wantProfile)
+			}
+			pod, _ := client.CoreV1().Pods("default").Get(context.Background(), "test-pod", metav1.GetOptions{})
+			if len(pod.Spec.EphemeralContainers) != 1 {
+				t.Fatalf("expected one ephemeral container, got %d", len(pod.Spec.EphemeralContainers))
+			}
+			ec := pod.Spec.EphemeralContainers[0]
+			if ec.Image != tt.wantImage {
+				t.Errorf("image = %s, want %s", ec.Image, tt.wantImage)
+			}
+			if !stringSliceEqual(ec.Command, tt.wantCommand) {
+				t.Errorf("command = %v, want %v", ec.Command, tt.wantCommand)
+			}
+		})
+	}
+}
+
+func TestToolkitDryRun(t *testing.T) {
+	defer cmd.SetClientset(nil)
+	defer cmd.SetProfile("")
+	defer cmd.SetToolkit("", nil)
+	defer cmd.SetImage("jbuet/debug:latest")
+	defer cmd.SetDryRun("none", "yaml")
+
+	// The label of debug:plain says root, its name says nonroot
+	registry := newRegistry(t, map[string]string{"plain": "true", "tools": "false"})
+	toolkits := map[string]debug.Toolkit{
+		"tools": {Images: []string{registry + "/debug:plain", registry + "/debug:tools"}},
+	}
+
+	client := newClientset(newTargetPod("test-pod", "default"))
+	cmd.SetClientset(client)
+	cmd.SetNamespace("default")
+	cmd.SetPodName("test-pod")
+	cmd.SetContainer("")
+	cmd.SetCopyPod(false)
+	cmd.SetProfile("restricted")
+	cmd.SetToolkit("tools", toolkits)
+	cmd.SetDryRun("client", "yaml")
+
+	out, err := captureStdout(t, cmd.RunDebug)
+	if err != nil {
+		t.Fatalf("RunDebug() error = %v", err)
+	}
+	if want := "image: " + registry + "/debug:plain"; !strings.Contains(out, want) {
+		t.Errorf("dry run read the image labels, output does not contain %q:\n%s", want, out)
+	}
+}
@@ -0,0 +1,209 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jbuet/kubectl-debug/cmd"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/watch"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// newPendingDebugPod returns a debug pod whose container is waiting for reason
+func newPendingDebugPod(reason, message string) *corev1.Pod {
+	pod := newDebugPod("debug-pod", "default", "")
+	pod.Spec.Containers = []corev1.Container{{Name: "debugger", Image: "debug:latest"}}
+	pod.Status.Phase = corev1.PodPending
+	if reason != "" {
+		pod.Status.ContainerStatuses = []corev1.ContainerStatus{{
+			Name:  "debugger",
+			Image: "debug:latest",
+			State: corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: reason, Message: message}},
+		}}
+	}
+	return pod
+}
+
+func newPodEvent(name, eventType, reason, message string) *corev1.Event {
+	return &corev1.Event{
+		ObjectMeta:     metav1.ObjectMeta{Name: name, Namespace: "default"},
+		InvolvedObject: corev1.ObjectReference{Kind: "Pod", Name: "debug-pod", Namespace: "default"},
+		Type:           eventType,
+		Reason:         reason,
+		Message:        message,
+	}
+}
+
+func setRunning(pod *corev1.Pod) {
+	pod.Status.Phase = corev1.PodRunning
+	pod.Status.ContainerStatuses = []corev1.ContainerStatus{{
+		Name:  "debugger",
+		Image: "debug:latest",
+		State: corev1.ContainerState{Running: &corev1.ContainerStateRunning{}},
+	}}
+}
+
+func TestWaitForPod(t *testing.T) {
+	defer cmd.SetClientset(nil)
+	defer cmd.SetWaitTimeout(30 * time.Second)
+
+	running := newPendingDebugPod("", "")
+	setRunning(running)
+
+	unschedulable := newPendingDebugPod("", "")
+	unschedulable.Status.Conditions = []corev1.PodCondition{{
+		Type:    corev1.PodScheduled,
+		Status:  corev1.ConditionFalse,
+		Reason:  corev1.PodReasonUnschedulable,
+		Message: "0/12 nodes are available: 12 Insufficient memory.",
+	}}
+
+	tests := []struct {
+		name    string
+		objects []runtime.Object
+		wantErr string
+	}{
+		{name: "Already running", objects: []runtime.Object{running}},
+		{
+			name: "Image pull failure",
+			objects: []runtime.Object{
+				newPendingDebugPod("ImagePullBackOff", `Back-off pulling image "debug:latest"`),
+				newPodEvent("pull", corev1.EventTypeWarning, "Failed", `Failed to pull image "debug:latest": 401 Unauthorized`),
+			},
+			wantErr: "image debug:latest could not be pulled: Failed to pull image \"debug:latest\": 401 Unauthorized",
+		},
+		{
+			name:    "Container config error",
+			objects: []runtime.Object{newPendingDebugPod("CreateContainerConfigError", `secret "token" not found`)},
+			wantErr: `container debugger cannot start: secret "token" not found`,
+		},
+		{
+			name:    "Unschedulable",
+			objects: []runtime.Object{unschedulable},
+			wantErr: "cannot be scheduled: 0/12 nodes are available: 12 Insufficient memory.",
+		},
+		{
+			name: "Unschedulable while scaling up",
+			objects: []runtime.Object{
+				unschedulable,
+				newPodEvent("scale-up", corev1.EventTypeNormal, "TriggeredScaleUp", "pod triggered scale-up"),
+			},
+			wantErr: "pod debug-pod was not ready after",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd.SetClientset(newClientset(tt.objects...))
+			cmd.SetNamespace("default")
+			cmd.SetWaitTimeout(100 * time.Millisecond)
+
+			err := cmd.WaitForPod("debug-pod")
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("WaitForPod() error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("WaitForPod() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestWaitForPodWatchesUpdates(t *testing.T) {
+	defer cmd.SetClientset(nil)
+	defer cmd.SetWaitTimeout(30 * time.Second)
+
+	client := newClientset(newPendingDebugPod("ContainerCreating", ""))
+	cmd.SetClientset(client)
+	cmd.SetNamespace("default")
+	cmd.SetWaitTimeout(5 * time.Second)
+
+	// Start the pod once the watch is established
+	client.PrependWatchReactor("pods", func(action k8stesting.Action) (bool, watch.Interface, error) {
+		go func() {
+			time.Sleep(50 * time.Millisecond)
+			pod, _ := client.CoreV1().Pods("default").Get(context.Background(), "debug-pod", metav1.GetOptions{})
+			setRunning(pod)
+			client.CoreV1().Pods("default").UpdateStatus(context.Background(), pod, metav1.UpdateOptions{})
+		}()
+		return false, nil, nil
+	})
+
+	if err := cmd.WaitForPod("debug-pod"); err != nil {
+		t.Errorf("WaitForPod() error = %v", err)
+	}
+}
+
+func TestWaitForPodResumesExpiredWatch(t *testing.T) {
+	defer cmd.SetClientset(nil)
+	defer cmd.SetWaitTimeout(30 * time.Second)
+
+	pending := newPendingDebugPod("ContainerCreating", "")
+	pending.ResourceVersion = "1"
+	client := newClientset(pending)
+	cmd.SetClientset(client)
+	cmd.SetNamespace("default")
+	cmd.SetWaitTimeout(5 * time.Second)
+
+	// The first watch expires after the pod changed, the second one must
+	// start from the version read again
+	var resumedAt []string
+	client.PrependWatchReactor("pods", func(action k8stesting.Action) (bool, watch.Interface, error) {
+		w := watch.NewFake()
+		resumedAt = append(resumedAt, action.(k8stesting.WatchActionImpl).WatchRestrictions.ResourceVersion)
+		if len(resumedAt) == 1 {
+			go func() {
+				pod := pending.DeepCopy()
+				pod.ResourceVersion = "7"
+				client.Tracker().Update(corev1.SchemeGroupVersion.WithResource("pods"), pod, "default")
+				w.Error(&metav1.Status{Status: metav1.StatusFailure, Code: 410, Reason: metav1.StatusReasonExpired})
+			}()
+		} else {
+			go func() {
+				pod := pending.DeepCopy()
+				pod.ResourceVersion = "8"
+				setRunning(pod)
+				w.Modify(pod)
+			}()
+		}
+		return true, w, nil
+	})
+
+	if err := cmd.WaitForPod("debug-pod"); err != nil {
+		t.Fatalf("WaitForPod() error = %v", err)
+	}
+	if !stringSliceEqual(resumedAt, []string{"1", "7"}) {
+		t.Errorf("pod watched from versions %v, want [1 7]", resumedAt)
+	}
+}
+
+func TestPodSecurityRejection(t *testing.T) {
+	defer cmd.SetClientset(nil)
+
+	client := newClientset()
+	client.PrependReactor("create", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, apierrors.NewForbidden(schema.GroupResource{Resource: "pods"}, "debug",
+			errors.New(`violates PodSecurity "restricted:latest": allowPrivilegeEscalation != false`))
+	})
+	cmd.SetClientset(client)
+	cmd.SetNamespace("default")
+	cmd.SetPodName("")
+	cmd.SetProfile("privileged")
+	defer cmd.SetProfile("")
+
+	err := cmd.RunDebug()
+	if err == nil || !strings.Contains(err.Error(), `debug pod violates PodSecurity "restricted:latest"`) {
+		t.Errorf("RunDebug() error = %v, want a PodSecurity explanation", err)
+	}
+}